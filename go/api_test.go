@@ -0,0 +1,53 @@
+package evm_test
+
+import (
+	"testing"
+
+	evm "evm-from-scratch-go"
+)
+
+// doubler returns its input twice over.
+type doubler struct{}
+
+func (doubler) Gas(input []byte) uint64 {
+	return 10
+}
+
+func (doubler) Run(call evm.PrecompileCall) ([]byte, error) {
+	return append(append([]byte(nil), call.Input...), call.Input...), nil
+}
+
+// TestPublicAPI runs code from outside the package, with every part of the
+// API a caller supplies: the block context, the state, the chain config and
+// custom precompiles.
+func TestPublicAPI(t *testing.T) {
+	state, err := evm.NewMemStateDB(evm.Accounts{"0xaa": {Balance: "0x1"}})
+	if err != nil {
+		t.Fatalf("NewMemStateDB error %v", err)
+	}
+	Block := evm.BlockContext{
+		Number:  "0x1",
+		GetHash: func(number uint64) evm.Word { return *evm.NewWord(number) },
+	}
+	precompiles := map[evm.Address]evm.Precompile{evm.HexToAddress("0xfe01"): doubler{}}
+
+	// CALL(0xffff, 0xfe01, 0, 0, 1, 0, 0), RETURNDATASIZE
+	code := []byte{0x60, 0x00, 0x60, 0x00, 0x60, 0x01, 0x60, 0x00, 0x60, 0x00, 0x61, 0xfe, 0x01, 0x61, 0xff, 0xff, 0xf1, 0x3d}
+	for name, run := range map[string]func() *evm.ExecutionResult{
+		"Evm": func() *evm.ExecutionResult {
+			return evm.Evm(code, evm.Transaction{To: "0xcc"}, Block, state, precompiles)
+		},
+		"Interpreter": func() *evm.ExecutionResult {
+			in := &evm.Interpreter{Config: evm.MainnetChainConfig, Precompiles: precompiles}
+			return in.Run(code, evm.Transaction{To: "0xcc"}, Block, state)
+		},
+	} {
+		res := run()
+		if res.Failed() {
+			t.Fatalf("%s: Err = %v", name, res.Err)
+		}
+		if got := res.Stack[0].Uint64(); got != 2 {
+			t.Errorf("%s: RETURNDATASIZE = %d; want 2", name, got)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// blake2FInput is the EIP-152 test input hashing "abc" in one block, with the
+// given rounds and final-block flag.
+func blake2FInput(rounds, final string) string {
+	h := "48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e1319cde05b"
+	m := "616263" + strings.Repeat("00", 125)
+	t := "03" + strings.Repeat("00", 15)
+	return rounds + h + m + t + final
+}
+
+func TestBlake2F(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		gas   uint64
+	}{
+		// BLAKE2b-512("abc").
+		{"12 rounds", blake2FInput("0000000c", "01"), "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923", 12},
+		{"not final", blake2FInput("0000000c", "00"), "75ab69d3190a562c51aef8d88f1c2775876944407270c42c9844252c26d2875298743e7f6d5ea2f2d3e8d226039cd31b4e426ac4f2d3d666a610c2116fde4735", 12},
+		{"1 round", blake2FInput("00000001", "01"), "b63a380cb2897d521994a85234ee2c181b5f844d2c624c002677e9703449d2fba551b3a8333bcdf5f2f7e08993d53923de3d64fcc68c034e717b9293fed7a421", 1},
+		{"0 rounds", blake2FInput("00000000", "01"), "08c9bcf367e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5d282e6ad7f520e511f6c3e2b8c68059b9442be0454267ce079217e1319cde05b", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := precompiles[HexToAddress("0x9")]
+			input, _ := hex.DecodeString(tt.input)
+			if got := p.gas(input); got != tt.gas {
+				t.Errorf("gas = %d; want %d", got, tt.gas)
+			}
+			out, err := p.run(input)
+			if err != nil {
+				t.Fatalf("run error %v", err)
+			}
+			if got := hex.EncodeToString(out); got != tt.want {
+				t.Errorf("run = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlake2FInvalidInput(t *testing.T) {
+	valid := blake2FInput("0000000c", "01")
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"short", valid[:len(valid)-2]},
+		{"long", valid + "00"},
+		{"bad final flag", blake2FInput("0000000c", "02")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := hex.DecodeString(tt.input)
+			if _, err := (blake2F{}).run(input); !errors.Is(err, ErrPrecompileInput) {
+				t.Errorf("run error %v; want ErrPrecompileInput", err)
+			}
+		})
+	}
+}
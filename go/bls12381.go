@@ -0,0 +1,392 @@
+package evm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// BLS12-381 is the pairing-friendly curve of the KZG commitments checked by
+// the point evaluation precompile (EIP-4844). G1 is the curve y² = x³ + 4 over
+// Fp; G2 is the twist y² = x³ + 4ξ over Fp2, where ξ = 1 + i. The pairing is
+// the optimal ate pairing into Fp12, built as the same tower as for BN254:
+//
+//	Fp2  = Fp[i]/(i² + 1)
+//	Fp6  = Fp2[v]/(v³ - ξ)
+//	Fp12 = Fp6[w]/(w² - v)
+//
+// As for BN254, this uses math/big and affine coordinates throughout.
+var (
+	blsP     = mustParseBig("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaaab")
+	blsOrder = mustParseBig("73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001")
+	blsG1    = &shortCurve{p: blsP, b: big.NewInt(4)}
+
+	blsG1Gen = &curvePoint{
+		mustParseBig("17f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb"),
+		mustParseBig("08b3f481e3aaa0f1a09e30ed741d8ae4fcf5e095d5d00af600db18cb2c04b3edd03cc744a2888ae40caa232946c5e7e1"),
+	}
+	blsG2Gen = &blsTwistPoint{
+		blsFp2{mustParseBig("024aa2b2f08f0a91260805272dc51051c6e47ad4fa403b02b4510b647ae3d1770bac0326a805bbefd48056c8c121bdb8"), mustParseBig("13e02b6052719f607dacd3a088274f65596bd0d09920b61ab5da61bbdc7f5049334cf11213945d57e5ac7d055d042b7e")},
+		blsFp2{mustParseBig("0ce5d527727d6e118cc9cdc6da2e351aadfd9baa8cbdd3a76d429a695160d12c923ac9cc3baca289e193548608b82801"), mustParseBig("0606c4a02ea734cc32acd2b02bc28b99cb3e287e85a763af267492ab572e99ab3f370d275cec1da1aaa9075ff05f79be")},
+	}
+
+	// blsAteLoop is |x| for the curve parameter x = -0xd201000000010000.
+	blsAteLoop = mustParseBig("d201000000010000")
+
+	blsXi = blsFp2{big.NewInt(1), big.NewInt(1)}
+
+	// kzgTauG2 is τ·G2 for the secret τ of the KZG trusted setup
+	// (https://github.com/ethereum/kzg-ceremony).
+	kzgTauG2 = &blsTwistPoint{
+		blsFp2{mustParseBig("185cbfee53492714734429b7b38608e23926c911cceceac9a36851477ba4c60b087041de621000edc98edada20c1def2"), mustParseBig("15bfd7dd8cdeb128843bc287230af38926187075cbfbefa81009a2ce615ac53d2914e5870cb452d2afaaab24f3499f72")},
+		blsFp2{mustParseBig("014353bdb96b626dd7d5ee8599d1fca2131569490e28de18e82451a496a9c9794ce26d105941f383ee689bfbbb832a99"), mustParseBig("1666c54b0a32529503432fcae0181b4bef79de09fc63671fda5ed1ba9bfa07899495346f3d7ac9cd23048ef30d0a154f")},
+	}
+
+	// blsFrobenius holds ξ^(k(p-1)/6) for k = 0..5: the Frobenius map takes
+	// w^k to w^(kp) = ξ^(k(p-1)/6)·w^k.
+	blsFrobenius = func() (g [6]blsFp2) {
+		e := new(big.Int).Sub(blsP, big.NewInt(1))
+		e.Div(e, big.NewInt(6))
+		g[0] = blsFp2One()
+		g[1] = blsXi.exp(e)
+		for k := 2; k < 6; k++ {
+			g[k] = g[k-1].mul(g[1])
+		}
+		return g
+	}()
+)
+
+// blsMod reduces x modulo p in place and returns it.
+func blsMod(x *big.Int) *big.Int {
+	return x.Mod(x, blsP)
+}
+
+// blsFp2 is a + b·i. Values are never modified once made.
+type blsFp2 struct {
+	a, b *big.Int
+}
+
+func blsFp2Zero() blsFp2 { return blsFp2{new(big.Int), new(big.Int)} }
+func blsFp2One() blsFp2  { return blsFp2{big.NewInt(1), new(big.Int)} }
+
+func (x blsFp2) isZero() bool        { return x.a.Sign() == 0 && x.b.Sign() == 0 }
+func (x blsFp2) equal(y blsFp2) bool { return x.a.Cmp(y.a) == 0 && x.b.Cmp(y.b) == 0 }
+
+// blsReduce brings x, which is within p of the range [0, p), into it. It is
+// much cheaper than blsMod for the sums and differences of reduced values.
+func blsReduce(x *big.Int) *big.Int {
+	switch {
+	case x.Sign() < 0:
+		return x.Add(x, blsP)
+	case x.Cmp(blsP) >= 0:
+		return x.Sub(x, blsP)
+	}
+	return x
+}
+
+func (x blsFp2) add(y blsFp2) blsFp2 {
+	return blsFp2{blsReduce(new(big.Int).Add(x.a, y.a)), blsReduce(new(big.Int).Add(x.b, y.b))}
+}
+
+func (x blsFp2) sub(y blsFp2) blsFp2 {
+	return blsFp2{blsReduce(new(big.Int).Sub(x.a, y.a)), blsReduce(new(big.Int).Sub(x.b, y.b))}
+}
+
+func (x blsFp2) neg() blsFp2 {
+	return blsFp2Zero().sub(x)
+}
+
+func (x blsFp2) mul(y blsFp2) blsFp2 {
+	ac, bd := new(big.Int).Mul(x.a, y.a), new(big.Int).Mul(x.b, y.b)
+	ad, bc := new(big.Int).Mul(x.a, y.b), new(big.Int).Mul(x.b, y.a)
+	return blsFp2{blsMod(ac.Sub(ac, bd)), blsMod(ad.Add(ad, bc))}
+}
+
+func (x blsFp2) mulScalar(k *big.Int) blsFp2 {
+	return blsFp2{blsMod(new(big.Int).Mul(x.a, k)), blsMod(new(big.Int).Mul(x.b, k))}
+}
+
+// conj returns a - b·i.
+func (x blsFp2) conj() blsFp2 {
+	return blsFp2{x.a, blsMod(new(big.Int).Neg(x.b))}
+}
+
+func (x blsFp2) exp(k *big.Int) blsFp2 {
+	r := blsFp2One()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.mul(r)
+		if k.Bit(i) == 1 {
+			r = r.mul(x)
+		}
+	}
+	return r
+}
+
+// inv returns 1/x, for x ≠ 0.
+func (x blsFp2) inv() blsFp2 {
+	norm := new(big.Int).Mul(x.a, x.a)
+	norm.Add(norm, new(big.Int).Mul(x.b, x.b))
+	norm.ModInverse(blsMod(norm), blsP)
+	return x.conj().mulScalar(norm)
+}
+
+// blsFp6 is c0 + c1·v + c2·v².
+type blsFp6 struct {
+	c0, c1, c2 blsFp2
+}
+
+func blsFp6Zero() blsFp6 { return blsFp6{blsFp2Zero(), blsFp2Zero(), blsFp2Zero()} }
+func blsFp6One() blsFp6  { return blsFp6{blsFp2One(), blsFp2Zero(), blsFp2Zero()} }
+
+func (x blsFp6) equal(y blsFp6) bool {
+	return x.c0.equal(y.c0) && x.c1.equal(y.c1) && x.c2.equal(y.c2)
+}
+
+func (x blsFp6) add(y blsFp6) blsFp6 { return blsFp6{x.c0.add(y.c0), x.c1.add(y.c1), x.c2.add(y.c2)} }
+func (x blsFp6) sub(y blsFp6) blsFp6 { return blsFp6{x.c0.sub(y.c0), x.c1.sub(y.c1), x.c2.sub(y.c2)} }
+func (x blsFp6) neg() blsFp6         { return blsFp6{x.c0.neg(), x.c1.neg(), x.c2.neg()} }
+
+func (x blsFp6) mul(y blsFp6) blsFp6 {
+	return blsFp6{
+		x.c0.mul(y.c0).add(blsXi.mul(x.c1.mul(y.c2).add(x.c2.mul(y.c1)))),
+		x.c0.mul(y.c1).add(x.c1.mul(y.c0)).add(blsXi.mul(x.c2.mul(y.c2))),
+		x.c0.mul(y.c2).add(x.c1.mul(y.c1)).add(x.c2.mul(y.c0)),
+	}
+}
+
+// mulV returns x·v.
+func (x blsFp6) mulV() blsFp6 {
+	return blsFp6{blsXi.mul(x.c2), x.c0, x.c1}
+}
+
+// inv returns 1/x, for x ≠ 0.
+func (x blsFp6) inv() blsFp6 {
+	a := x.c0.mul(x.c0).sub(blsXi.mul(x.c1.mul(x.c2)))
+	b := blsXi.mul(x.c2.mul(x.c2)).sub(x.c0.mul(x.c1))
+	c := x.c1.mul(x.c1).sub(x.c0.mul(x.c2))
+	norm := x.c0.mul(a).add(blsXi.mul(x.c2.mul(b).add(x.c1.mul(c)))).inv()
+	return blsFp6{a.mul(norm), b.mul(norm), c.mul(norm)}
+}
+
+// blsFp12 is c0 + c1·w.
+type blsFp12 struct {
+	c0, c1 blsFp6
+}
+
+func blsFp12One() blsFp12 { return blsFp12{blsFp6One(), blsFp6Zero()} }
+
+func (x blsFp12) isOne() bool {
+	return x.c0.equal(blsFp6One()) && x.c1.equal(blsFp6Zero())
+}
+
+func (x blsFp12) mul(y blsFp12) blsFp12 {
+	return blsFp12{
+		x.c0.mul(y.c0).add(x.c1.mul(y.c1).mulV()),
+		x.c0.mul(y.c1).add(x.c1.mul(y.c0)),
+	}
+}
+
+// conj returns c0 - c1·w, which is also x^(p⁶).
+func (x blsFp12) conj() blsFp12 {
+	return blsFp12{x.c0, x.c1.neg()}
+}
+
+// inv returns 1/x, for x ≠ 0.
+func (x blsFp12) inv() blsFp12 {
+	norm := x.c0.mul(x.c0).sub(x.c1.mul(x.c1).mulV()).inv()
+	return blsFp12{x.c0.mul(norm), x.c1.neg().mul(norm)}
+}
+
+// frobenius returns x^p. Each coefficient is conjugated, which is its own
+// p-th power, and the power of w it goes with is moved by blsFrobenius.
+func (x blsFp12) frobenius() blsFp12 {
+	g := &blsFrobenius
+	return blsFp12{
+		blsFp6{x.c0.c0.conj(), x.c0.c1.conj().mul(g[2]), x.c0.c2.conj().mul(g[4])},
+		blsFp6{x.c1.c0.conj().mul(g[1]), x.c1.c1.conj().mul(g[3]), x.c1.c2.conj().mul(g[5])},
+	}
+}
+
+// expX returns x^u for the curve parameter u = -blsAteLoop. It is only valid
+// after the easy part of the final exponentiation, where 1/x = conj(x).
+func (x blsFp12) expX() blsFp12 {
+	return x.exp(blsAteLoop).conj()
+}
+
+func (x blsFp12) exp(k *big.Int) blsFp12 {
+	r := blsFp12One()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.mul(r)
+		if k.Bit(i) == 1 {
+			r = r.mul(x)
+		}
+	}
+	return r
+}
+
+// blsTwistPoint is an affine point of G2, on the twist. The point at infinity
+// is nil.
+type blsTwistPoint struct {
+	x, y blsFp2
+}
+
+// neg returns -a.
+func (a *blsTwistPoint) neg() *blsTwistPoint {
+	if a == nil {
+		return nil
+	}
+	return &blsTwistPoint{a.x, a.y.neg()}
+}
+
+// blsTwistSlope returns the slope of the line through a and b, or the tangent
+// at a if they are equal, and false if that line is vertical.
+func blsTwistSlope(a, b *blsTwistPoint) (blsFp2, bool) {
+	if a.x.equal(b.x) {
+		if !a.y.equal(b.y) || a.y.isZero() {
+			return blsFp2{}, false
+		}
+		// Doubling: slope = 3x² / 2y.
+		return a.x.mul(a.x).mulScalar(big.NewInt(3)).mul(a.y.add(a.y).inv()), true
+	}
+	return b.y.sub(a.y).mul(b.x.sub(a.x).inv()), true
+}
+
+// blsTwistAdd returns a + b.
+func blsTwistAdd(a, b *blsTwistPoint) *blsTwistPoint {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	slope, ok := blsTwistSlope(a, b)
+	if !ok {
+		return nil // a = -b
+	}
+	x := slope.mul(slope).sub(a.x).sub(b.x)
+	y := slope.mul(a.x.sub(x)).sub(a.y)
+	return &blsTwistPoint{x, y}
+}
+
+// blsTwistScalarMult returns k·a, for k ≥ 0.
+func blsTwistScalarMult(a *blsTwistPoint, k *big.Int) *blsTwistPoint {
+	var r *blsTwistPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = blsTwistAdd(r, r)
+		if k.Bit(i) == 1 {
+			r = blsTwistAdd(r, a)
+		}
+	}
+	return r
+}
+
+// blsLineStep returns the line through t and q (the tangent if they are
+// equal) evaluated at p, along with t + q. The line is only defined up to a
+// factor in a proper subfield of Fp12, which the final exponentiation removes.
+//
+// Unlike BN254's, this twist untwists a point (x, y) to (x/w², y/w³), so a
+// line of slope λ on the twist has slope λ/w, and evaluated at p and scaled by
+// w³ it is λ·x_t - y_t - λ·x_p·v + y_p·v·w.
+func blsLineStep(t, q *blsTwistPoint, p *curvePoint) (blsFp12, *blsTwistPoint) {
+	xp, yp := blsFp2{p.x, new(big.Int)}, blsFp2{p.y, new(big.Int)}
+	slope, ok := blsTwistSlope(t, q)
+	if !ok {
+		// The vertical line x = x_t, scaled by w²: x_p·v - x_t.
+		return blsFp12{blsFp6{t.x.neg(), xp, blsFp2Zero()}, blsFp6Zero()}, blsTwistAdd(t, q)
+	}
+	line := blsFp12{
+		blsFp6{slope.mul(t.x).sub(t.y), slope.mul(xp).neg(), blsFp2Zero()},
+		blsFp6{blsFp2Zero(), yp, blsFp2Zero()},
+	}
+	return line, blsTwistAdd(t, q)
+}
+
+// blsMillerLoop returns the Miller loop of the optimal ate pairing of p and q,
+// before the final exponentiation.
+func blsMillerLoop(p *curvePoint, q *blsTwistPoint) blsFp12 {
+	f, t := blsFp12One(), q
+	var line blsFp12
+	for i := blsAteLoop.BitLen() - 2; i >= 0; i-- {
+		line, t = blsLineStep(t, t, p)
+		f = f.mul(f).mul(line)
+		if blsAteLoop.Bit(i) == 1 {
+			line, t = blsLineStep(t, q, p)
+			f = f.mul(line)
+		}
+	}
+	// The curve parameter is negative.
+	return f.conj()
+}
+
+// blsFinalExponentiation returns f^(3(p¹² - 1)/r). The factor of 3 makes the
+// hard part quicker, and as it is prime to r it does not change which values
+// are one.
+func blsFinalExponentiation(f blsFp12) blsFp12 {
+	// The easy part, f^((p⁶ - 1)(p² + 1)).
+	f = f.conj().mul(f.inv())
+	f = f.frobenius().frobenius().mul(f)
+
+	// The hard part, 3(p⁴ - p² + 1)/r = (u - 1)²(u + p)(u² + p² - 1) + 3.
+	t := f.expX().mul(f.conj())
+	t = t.expX().mul(t.conj())
+	t = t.expX().mul(t.frobenius())
+	t = t.expX().expX().mul(t.frobenius().frobenius()).mul(t.conj())
+	return t.mul(f.mul(f).mul(f))
+}
+
+// blsPairingCheck reports whether the product of the pairings e(ps[i], qs[i])
+// is one. Pairs with a point at infinity contribute nothing.
+func blsPairingCheck(ps []*curvePoint, qs []*blsTwistPoint) bool {
+	f := blsFp12One()
+	for i := range ps {
+		if ps[i] == nil || qs[i] == nil {
+			continue
+		}
+		f = f.mul(blsMillerLoop(ps[i], qs[i]))
+	}
+	return blsFinalExponentiation(f).isOne()
+}
+
+// verifyKzgProof reports whether proof shows that the polynomial committed to
+// by c takes the value y at z: that is, whether
+//
+//	e(c - y·G1, G2) = e(proof, τ·G2 - z·G2).
+func verifyKzgProof(c *curvePoint, z, y *big.Int, proof *curvePoint) bool {
+	p := blsG1.add(c, blsG1.neg(blsG1.scalarMult(blsG1Gen, y)))
+	q := blsTwistAdd(kzgTauG2, blsTwistScalarMult(blsG2Gen, z).neg())
+	return blsPairingCheck([]*curvePoint{p, proof}, []*blsTwistPoint{blsG2Gen.neg(), q})
+}
+
+// decodeBlsG1 decodes a point of G1 in the 48-byte compressed form: the x
+// coordinate, with the top three bits of the first byte flagging compression
+// (always set), the point at infinity, and which of the two y coordinates is
+// meant (the larger one, if set). Points off the curve, or not in the subgroup
+// of order r, are rejected with ErrPrecompileInput.
+func decodeBlsG1(b []byte) (*curvePoint, error) {
+	flags := b[0] & 0xe0
+	x := new(big.Int).SetBytes(append([]byte{b[0] & 0x1f}, b[1:]...))
+	switch {
+	case flags&0x80 == 0:
+		return nil, fmt.Errorf("%w: uncompressed G1 point", ErrPrecompileInput)
+	case flags&0x40 != 0:
+		if flags&0x20 != 0 || x.Sign() != 0 {
+			return nil, fmt.Errorf("%w: malformed G1 point at infinity", ErrPrecompileInput)
+		}
+		return nil, nil
+	case x.Cmp(blsP) >= 0:
+		return nil, fmt.Errorf("%w: G1 coordinate not in the field", ErrPrecompileInput)
+	}
+	// As p = 3 mod 4, a square root of a is a^((p+1)/4), if it has one.
+	rhs := blsG1.rhs(x)
+	y := new(big.Int).Exp(rhs, new(big.Int).Rsh(new(big.Int).Add(blsP, big.NewInt(1)), 2), blsP)
+	if blsMod(new(big.Int).Mul(y, y)).Cmp(rhs) != 0 {
+		return nil, fmt.Errorf("%w: G1 point not on the curve", ErrPrecompileInput)
+	}
+	if larger := y.Cmp(new(big.Int).Rsh(blsP, 1)) > 0; larger != (flags&0x20 != 0) {
+		y.Sub(blsP, y)
+	}
+	p := &curvePoint{x, y}
+	if blsG1.scalarMult(p, blsOrder) != nil {
+		return nil, fmt.Errorf("%w: G1 point not in the subgroup", ErrPrecompileInput)
+	}
+	return p, nil
+}
@@ -0,0 +1,304 @@
+package evm
+
+import "math/big"
+
+// BN254 (alt_bn128) is the pairing-friendly curve of the ECADD, ECMUL and
+// ECPAIRING precompiles (EIP-196, EIP-197). G1 is the curve y² = x³ + 3 over
+// Fp; G2 is the twist y² = x³ + 3/ξ over Fp2, where ξ = 9 + i. The pairing is
+// the optimal ate pairing into Fp12, built as the tower
+//
+//	Fp2  = Fp[i]/(i² + 1)
+//	Fp6  = Fp2[v]/(v³ - ξ)
+//	Fp12 = Fp6[w]/(w² - v)
+//
+// Like shortCurve, this uses math/big and affine coordinates throughout.
+var (
+	bn254P     = mustParseBig("30644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd47")
+	bn254Order = mustParseBig("30644e72e131a029b85045b68181585d2833e84879b9709143e1f593f0000001")
+	bn254G1    = &shortCurve{p: bn254P, b: big.NewInt(3)}
+
+	// bn254AteLoop is 6u+2, for the curve parameter u = 4965661367192848881.
+	bn254AteLoop, _ = new(big.Int).SetString("29793968203157093288", 10)
+
+	xi = fp2{big.NewInt(9), big.NewInt(1)}
+
+	// twistB is the b of the twist, 3/ξ.
+	twistB = xi.inv().mulScalar(big.NewInt(3))
+
+	// The Frobenius map on the twist multiplies the conjugated coordinates
+	// by ξ^((p-1)/3) and ξ^((p-1)/2).
+	frobeniusX = xi.exp(new(big.Int).Div(new(big.Int).Sub(bn254P, big.NewInt(1)), big.NewInt(3)))
+	frobeniusY = xi.exp(new(big.Int).Div(new(big.Int).Sub(bn254P, big.NewInt(1)), big.NewInt(2)))
+
+	// finalExpHard is (p⁴ - p² + 1)/r, the hard part of the final
+	// exponentiation (p¹² - 1)/r.
+	finalExpHard = func() *big.Int {
+		p2 := new(big.Int).Mul(bn254P, bn254P)
+		e := new(big.Int).Mul(p2, p2)
+		e.Sub(e, p2)
+		e.Add(e, big.NewInt(1))
+		return e.Div(e, bn254Order)
+	}()
+)
+
+// fpMod reduces x modulo p in place and returns it.
+func fpMod(x *big.Int) *big.Int {
+	return x.Mod(x, bn254P)
+}
+
+// fp2 is a + b·i. Values are never modified once made.
+type fp2 struct {
+	a, b *big.Int
+}
+
+func fp2Zero() fp2 { return fp2{new(big.Int), new(big.Int)} }
+func fp2One() fp2  { return fp2{big.NewInt(1), new(big.Int)} }
+
+func (x fp2) isZero() bool     { return x.a.Sign() == 0 && x.b.Sign() == 0 }
+func (x fp2) equal(y fp2) bool { return x.a.Cmp(y.a) == 0 && x.b.Cmp(y.b) == 0 }
+
+func (x fp2) add(y fp2) fp2 {
+	return fp2{fpMod(new(big.Int).Add(x.a, y.a)), fpMod(new(big.Int).Add(x.b, y.b))}
+}
+
+func (x fp2) sub(y fp2) fp2 {
+	return fp2{fpMod(new(big.Int).Sub(x.a, y.a)), fpMod(new(big.Int).Sub(x.b, y.b))}
+}
+
+func (x fp2) neg() fp2 {
+	return fp2Zero().sub(x)
+}
+
+func (x fp2) mul(y fp2) fp2 {
+	ac, bd := new(big.Int).Mul(x.a, y.a), new(big.Int).Mul(x.b, y.b)
+	ad, bc := new(big.Int).Mul(x.a, y.b), new(big.Int).Mul(x.b, y.a)
+	return fp2{fpMod(ac.Sub(ac, bd)), fpMod(ad.Add(ad, bc))}
+}
+
+func (x fp2) mulScalar(k *big.Int) fp2 {
+	return fp2{fpMod(new(big.Int).Mul(x.a, k)), fpMod(new(big.Int).Mul(x.b, k))}
+}
+
+// conj returns a - b·i, which is also x^p.
+func (x fp2) conj() fp2 {
+	return fp2{x.a, fpMod(new(big.Int).Neg(x.b))}
+}
+
+// inv returns 1/x, for x ≠ 0.
+func (x fp2) inv() fp2 {
+	norm := new(big.Int).Mul(x.a, x.a)
+	norm.Add(norm, new(big.Int).Mul(x.b, x.b))
+	norm.ModInverse(fpMod(norm), bn254P)
+	return x.conj().mulScalar(norm)
+}
+
+func (x fp2) exp(k *big.Int) fp2 {
+	r := fp2One()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.mul(r)
+		if k.Bit(i) == 1 {
+			r = r.mul(x)
+		}
+	}
+	return r
+}
+
+// fp6 is c0 + c1·v + c2·v².
+type fp6 struct {
+	c0, c1, c2 fp2
+}
+
+func fp6Zero() fp6 { return fp6{fp2Zero(), fp2Zero(), fp2Zero()} }
+func fp6One() fp6  { return fp6{fp2One(), fp2Zero(), fp2Zero()} }
+
+func (x fp6) equal(y fp6) bool {
+	return x.c0.equal(y.c0) && x.c1.equal(y.c1) && x.c2.equal(y.c2)
+}
+
+func (x fp6) add(y fp6) fp6 { return fp6{x.c0.add(y.c0), x.c1.add(y.c1), x.c2.add(y.c2)} }
+func (x fp6) sub(y fp6) fp6 { return fp6{x.c0.sub(y.c0), x.c1.sub(y.c1), x.c2.sub(y.c2)} }
+func (x fp6) neg() fp6      { return fp6{x.c0.neg(), x.c1.neg(), x.c2.neg()} }
+
+func (x fp6) mul(y fp6) fp6 {
+	return fp6{
+		x.c0.mul(y.c0).add(xi.mul(x.c1.mul(y.c2).add(x.c2.mul(y.c1)))),
+		x.c0.mul(y.c1).add(x.c1.mul(y.c0)).add(xi.mul(x.c2.mul(y.c2))),
+		x.c0.mul(y.c2).add(x.c1.mul(y.c1)).add(x.c2.mul(y.c0)),
+	}
+}
+
+// mulV returns x·v.
+func (x fp6) mulV() fp6 {
+	return fp6{xi.mul(x.c2), x.c0, x.c1}
+}
+
+// inv returns 1/x, for x ≠ 0.
+func (x fp6) inv() fp6 {
+	a := x.c0.mul(x.c0).sub(xi.mul(x.c1.mul(x.c2)))
+	b := xi.mul(x.c2.mul(x.c2)).sub(x.c0.mul(x.c1))
+	c := x.c1.mul(x.c1).sub(x.c0.mul(x.c2))
+	norm := x.c0.mul(a).add(xi.mul(x.c2.mul(b).add(x.c1.mul(c)))).inv()
+	return fp6{a.mul(norm), b.mul(norm), c.mul(norm)}
+}
+
+// fp12 is c0 + c1·w.
+type fp12 struct {
+	c0, c1 fp6
+}
+
+func fp12One() fp12 { return fp12{fp6One(), fp6Zero()} }
+
+func (x fp12) isOne() bool {
+	return x.c0.equal(fp6One()) && x.c1.equal(fp6Zero())
+}
+
+func (x fp12) mul(y fp12) fp12 {
+	return fp12{
+		x.c0.mul(y.c0).add(x.c1.mul(y.c1).mulV()),
+		x.c0.mul(y.c1).add(x.c1.mul(y.c0)),
+	}
+}
+
+// conj returns c0 - c1·w, which is also x^(p⁶).
+func (x fp12) conj() fp12 {
+	return fp12{x.c0, x.c1.neg()}
+}
+
+// inv returns 1/x, for x ≠ 0.
+func (x fp12) inv() fp12 {
+	norm := x.c0.mul(x.c0).sub(x.c1.mul(x.c1).mulV()).inv()
+	return fp12{x.c0.mul(norm), x.c1.neg().mul(norm)}
+}
+
+func (x fp12) exp(k *big.Int) fp12 {
+	r := fp12One()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.mul(r)
+		if k.Bit(i) == 1 {
+			r = r.mul(x)
+		}
+	}
+	return r
+}
+
+// twistPoint is an affine point of G2, on the twist. The point at infinity is
+// nil.
+type twistPoint struct {
+	x, y fp2
+}
+
+// isOnTwist reports whether (x, y) is a point of the twist.
+func isOnTwist(x, y fp2) bool {
+	return y.mul(y).equal(x.mul(x).mul(x).add(twistB))
+}
+
+// twistSlope returns the slope of the line through a and b, or the tangent at
+// a if they are equal, and false if that line is vertical.
+func twistSlope(a, b *twistPoint) (fp2, bool) {
+	if a.x.equal(b.x) {
+		if !a.y.equal(b.y) || a.y.isZero() {
+			return fp2{}, false
+		}
+		// Doubling: slope = 3x² / 2y.
+		return a.x.mul(a.x).mulScalar(big.NewInt(3)).mul(a.y.add(a.y).inv()), true
+	}
+	return b.y.sub(a.y).mul(b.x.sub(a.x).inv()), true
+}
+
+// twistAdd returns a + b.
+func twistAdd(a, b *twistPoint) *twistPoint {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	slope, ok := twistSlope(a, b)
+	if !ok {
+		return nil // a = -b
+	}
+	x := slope.mul(slope).sub(a.x).sub(b.x)
+	y := slope.mul(a.x.sub(x)).sub(a.y)
+	return &twistPoint{x, y}
+}
+
+// twistScalarMult returns k·a, for k ≥ 0.
+func twistScalarMult(a *twistPoint, k *big.Int) *twistPoint {
+	var r *twistPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = twistAdd(r, r)
+		if k.Bit(i) == 1 {
+			r = twistAdd(r, a)
+		}
+	}
+	return r
+}
+
+// frobenius returns the image of a under the p-power Frobenius map, moved
+// back onto the twist.
+func (a *twistPoint) frobenius() *twistPoint {
+	return &twistPoint{a.x.conj().mul(frobeniusX), a.y.conj().mul(frobeniusY)}
+}
+
+// lineStep returns the line through t and q (the tangent if they are equal)
+// evaluated at p, along with t + q. The line is only defined up to a factor
+// in Fp, which the final exponentiation removes.
+//
+// Untwisted, a point (x, y) of the twist is (x·w², y·w³), so a line of slope λ
+// on the twist has slope λ·w, and evaluated at p it is
+// y_p - λ·x_p·w + (λ·x_t - y_t)·v·w.
+func lineStep(t, q *twistPoint, p *curvePoint) (fp12, *twistPoint) {
+	xp, yp := fp2{p.x, new(big.Int)}, fp2{p.y, new(big.Int)}
+	slope, ok := twistSlope(t, q)
+	if !ok {
+		// The vertical line x = x_t, that is x_p - x_t·v.
+		return fp12{fp6{xp, t.x.neg(), fp2Zero()}, fp6Zero()}, twistAdd(t, q)
+	}
+	line := fp12{
+		fp6{yp, fp2Zero(), fp2Zero()},
+		fp6{slope.mul(xp).neg(), slope.mul(t.x).sub(t.y), fp2Zero()},
+	}
+	return line, twistAdd(t, q)
+}
+
+// millerLoop returns the Miller loop of the optimal ate pairing of p and q,
+// before the final exponentiation.
+func millerLoop(p *curvePoint, q *twistPoint) fp12 {
+	f, t := fp12One(), q
+	var line fp12
+	for i := bn254AteLoop.BitLen() - 2; i >= 0; i-- {
+		line, t = lineStep(t, t, p)
+		f = f.mul(f).mul(line)
+		if bn254AteLoop.Bit(i) == 1 {
+			line, t = lineStep(t, q, p)
+			f = f.mul(line)
+		}
+	}
+	q1 := q.frobenius()
+	q2 := q1.frobenius()
+	line, t = lineStep(t, q1, p)
+	f = f.mul(line)
+	line, _ = lineStep(t, &twistPoint{q2.x, q2.y.neg()}, p)
+	return f.mul(line)
+}
+
+// finalExponentiation returns f^((p¹² - 1)/r).
+func finalExponentiation(f fp12) fp12 {
+	// The easy part, f^((p⁶ - 1)(p² + 1)).
+	f = f.conj().mul(f.inv())
+	f = f.exp(new(big.Int).Mul(bn254P, bn254P)).mul(f)
+	return f.exp(finalExpHard)
+}
+
+// pairingCheck reports whether the product of the pairings e(ps[i], qs[i]) is
+// one. Pairs with a point at infinity contribute nothing.
+func pairingCheck(ps []*curvePoint, qs []*twistPoint) bool {
+	f := fp12One()
+	for i := range ps {
+		if ps[i] == nil || qs[i] == nil {
+			continue
+		}
+		f = f.mul(millerLoop(ps[i], qs[i]))
+	}
+	return finalExponentiation(f).isOne()
+}
@@ -0,0 +1,94 @@
+package evm
+
+import "math/big"
+
+// shortCurve is an elliptic curve y² = x³ + b over the prime field of order p,
+// the form of both secp256k1 and the G1 group of BN254. Points are affine;
+// the point at infinity is nil. This favours simplicity over speed, which is
+// plenty for precompile calls.
+type shortCurve struct {
+	p, b *big.Int
+}
+
+// curvePoint is an affine point on a shortCurve.
+type curvePoint struct {
+	x, y *big.Int
+}
+
+// isOnCurve reports whether (x, y) is a point of c with coordinates reduced
+// modulo p.
+func (c *shortCurve) isOnCurve(x, y *big.Int) bool {
+	if x.Sign() < 0 || x.Cmp(c.p) >= 0 || y.Sign() < 0 || y.Cmp(c.p) >= 0 {
+		return false
+	}
+	lhs := new(big.Int).Mul(y, y)
+	lhs.Mod(lhs, c.p)
+	return lhs.Cmp(c.rhs(x)) == 0
+}
+
+// rhs returns x³ + b mod p.
+func (c *shortCurve) rhs(x *big.Int) *big.Int {
+	r := new(big.Int).Mul(x, x)
+	r.Mul(r, x)
+	r.Add(r, c.b)
+	return r.Mod(r, c.p)
+}
+
+// add returns a + b.
+func (c *shortCurve) add(a, b *curvePoint) *curvePoint {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	var slope *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		if new(big.Int).Add(a.y, b.y).Cmp(c.p) == 0 || a.y.Sign() == 0 && b.y.Sign() == 0 {
+			return nil // a = -b
+		}
+		// Doubling: slope = 3x² / 2y.
+		slope = new(big.Int).Mul(a.x, a.x)
+		slope.Mul(slope, big.NewInt(3))
+		slope.Mul(slope, c.inverse(new(big.Int).Lsh(a.y, 1)))
+	} else {
+		slope = new(big.Int).Sub(b.y, a.y)
+		slope.Mul(slope, c.inverse(new(big.Int).Sub(b.x, a.x)))
+	}
+	slope.Mod(slope, c.p)
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, a.x)
+	x.Sub(x, b.x)
+	x.Mod(x, c.p)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, slope)
+	y.Sub(y, a.y)
+	y.Mod(y, c.p)
+	return &curvePoint{x, y}
+}
+
+// neg returns -a.
+func (c *shortCurve) neg(a *curvePoint) *curvePoint {
+	if a == nil {
+		return nil
+	}
+	y := new(big.Int).Sub(c.p, a.y)
+	return &curvePoint{a.x, y.Mod(y, c.p)}
+}
+
+// scalarMult returns k·a, for k ≥ 0.
+func (c *shortCurve) scalarMult(a *curvePoint, k *big.Int) *curvePoint {
+	var r *curvePoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = c.add(r, r)
+		if k.Bit(i) == 1 {
+			r = c.add(r, a)
+		}
+	}
+	return r
+}
+
+// inverse returns the multiplicative inverse of x modulo p.
+func (c *shortCurve) inverse(x *big.Int) *big.Int {
+	return new(big.Int).ModInverse(new(big.Int).Mod(x, c.p), c.p)
+}
@@ -0,0 +1,22 @@
+package evm
+
+import "errors"
+
+// Errors reported in ExecutionResult.Err. Callers should compare against them
+// with errors.Is, as they may be wrapped with additional context.
+var (
+	ErrStackUnderflow          = errors.New("stack underflow")
+	ErrStackOverflow           = errors.New("stack overflow")
+	ErrInvalidJump             = errors.New("invalid jump destination")
+	ErrInvalidOpcode           = errors.New("invalid opcode")
+	ErrWriteProtection         = errors.New("write protection")
+	ErrExecutionReverted       = errors.New("execution reverted")
+	ErrMemoryOutOfBounds       = errors.New("memory access out of bounds")
+	ErrOutOfGas                = errors.New("out of gas")
+	ErrInsufficientBalance     = errors.New("insufficient balance for transfer")
+	ErrReturnDataOutOfBounds   = errors.New("return data out of bounds")
+	ErrPrecompileInput         = errors.New("invalid precompile input")
+	ErrMaxCodeSizeExceeded     = errors.New("max code size exceeded")
+	ErrMaxInitCodeSizeExceeded = errors.New("max initcode size exceeded")
+	ErrInvalidCode             = errors.New("invalid code: must not begin with 0xef")
+)
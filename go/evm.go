@@ -12,7 +12,9 @@ package evm
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"strings"
 
@@ -26,6 +28,9 @@ type Transaction struct {
 	Gasprice string `json:"gasprice"`
 	Value    string `json:"value"`
 	Data     string `json:"data"`
+	Gas      string `json:"gas"` // gas limit; the block's gas limit if empty
+
+	BlobHashes []string `json:"blobVersionedHashes"` // versioned hashes of the blobs carried, for BLOBHASH
 }
 
 type Log struct {
@@ -34,19 +39,32 @@ type Log struct {
 	Topics  []string `json:"topics"`
 }
 
-type block struct {
-	Basefee    string `json:"basefee"`
-	Coinbase   string `json:"coinbase"`
-	Timestamp  string `json:"timestamp"`
-	Number     string `json:"number"`
-	Difficulty string `json:"difficulty"`
-	Gaslimit   string `json:"gaslimit"`
-	ChainId    string `json:"chainId"`
+// BlockContext is the block a transaction runs in.
+type BlockContext struct {
+	Basefee     string `json:"basefee"`
+	Coinbase    string `json:"coinbase"`
+	Timestamp   string `json:"timestamp"`
+	Number      string `json:"number"`
+	Difficulty  string `json:"difficulty"`
+	PrevRandao  string `json:"prevrandao"`
+	Gaslimit    string `json:"gaslimit"`
+	ChainId     string `json:"chainId"`
+	BlobBaseFee string `json:"blobBaseFee"`
+
+	// GetHash returns the hash of an earlier block, for BLOCKHASH. It is only
+	// asked about the 256 blocks before Number. If it is nil, every hash
+	// reads as zero.
+	GetHash func(number uint64) Word `json:"-"`
 }
 
+// blockHashWindow is how many of the most recent blocks BLOCKHASH can see.
+const blockHashWindow = 256
+
 type Account struct {
 	Balance  string   `json:"balance"`
+	Nonce    string   `json:"nonce,omitempty"`
 	UserCode usercode `json:"code"`
+	Storage  Store    `json:"storage,omitempty"`
 }
 
 type usercode struct {
@@ -54,1278 +72,824 @@ type usercode struct {
 	Bin string `json:"bin"`
 }
 
-type Store map[string]Storage
+// Store maps the storage slots of an account to their values. Slots that are
+// not present hold zero.
+type Store map[Word]Word
 
+// Accounts is the JSON form of the world state, keyed by hex address. Use
+// NewMemStateDB to run code against it.
 type Accounts map[string]Account
 
-func generateContractAddress(sender string, nonce uint64) string {
-	// Convert sender address to bytes
-	senderBytes, _ := hex.DecodeString(strings.TrimPrefix(sender, "0x"))
-
-	// Convert nonce to bytes
-	nonceBytes := new(big.Int).SetUint64(nonce).Bytes()
-
-	// Concatenate sender address and nonce
-	data := append(senderBytes, nonceBytes...)
-
-	// Hash the concatenated data to generate a unique address
-	hasher := sha3.NewLegacyKeccak256()
-	hasher.Write(data)
-	return "0x" + hex.EncodeToString(hasher.Sum(nil)[12:]) // Ethereum addresses are the last 20 bytes of the hash
+// createAddress returns the address of the contract that sender creates with
+// the given nonce: the last 20 bytes of keccak256(rlp([sender, nonce])).
+func createAddress(sender Address, nonce uint64) Address {
+	// The RLP list always fits in 55 bytes, so it has a one-byte header.
+	payload := append([]byte{0x80 + 20}, sender[:]...)
+	switch {
+	case nonce == 0:
+		payload = append(payload, 0x80)
+	case nonce < 0x80:
+		payload = append(payload, byte(nonce))
+	default:
+		n := new(big.Int).SetUint64(nonce).Bytes()
+		payload = append(append(payload, 0x80+byte(len(n))), n...)
+	}
+	hash := keccak256Word(append([]byte{0xc0 + byte(len(payload))}, payload...))
+	return wordToAddress(&hash)
 }
 
-func jumpdest(pc int, code []byte, stack []*big.Int) (int, []*big.Int, bool) {
-	stack = []*big.Int{}
-loop:
-	for i := pc; i < len(code); i++ {
-		if code[i] == 0x5B {
-
-			switch code[i-1] {
-			case 0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6A, 0x6B, 0x6C, 0x6D, 0x6E, 0x6F, 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7A, 0x7B, 0x7C, 0x7D, 0x7E, 0x7F:
-
-			default:
-				pc = i
-				break loop
-			}
-		}
-		if i == len(code)-1 && code[len(code)-1] != 0x5B {
-			return pc, stack, false
-		}
+// create2Address returns the address of the contract that sender creates with
+// CREATE2: the last 20 bytes of keccak256(0xff ++ sender ++ salt ++
+// keccak256(initCode)). Unlike createAddress it does not depend on the nonce,
+// so it can be known before the contract is deployed.
+func create2Address(sender Address, salt *Word, initCode []byte) Address {
+	saltBytes, codeHash := salt.Bytes32(), keccak256Word(initCode)
+	codeHashBytes := codeHash.Bytes32()
+	data := append([]byte{0xff}, sender[:]...)
+	data = append(data, saltBytes[:]...)
+	hash := keccak256Word(append(data, codeHashBytes[:]...))
+	return wordToAddress(&hash)
+}
 
+// hexToWord parses a "0x"-prefixed hex quantity from a transaction, block or
+// account field. Missing fields read as zero.
+func hexToWord(s string) *Word {
+	w := new(Word)
+	if value, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16); ok {
+		w.SetFromBig(value)
 	}
-	return pc, stack, true
+	return w
 }
 
-type Storage struct {
-	data      []byte
-	offsetMax int
+// hexToUint64 parses a hex number, saturated to the largest uint64.
+func hexToUint64(s string) uint64 {
+	w := hexToWord(s)
+	if !w.IsUint64() {
+		return math.MaxUint64
+	}
+	return w.Uint64()
 }
 
-func NewStorage(size int) *Storage {
-	return &Storage{
-		data:      make([]byte, size),
-		offsetMax: 0,
+// shiftAmount returns the shift operand of SHL, SHR and SAR, saturated to 256 so
+// that larger values shift every bit out.
+func shiftAmount(shift *Word) uint {
+	if !shift.IsUint64() || shift.Uint64() > 256 {
+		return 256
 	}
+	return uint(shift.Uint64())
 }
 
-// Store stores 32 bytes in memory at the specified offset.
-func (m *Storage) Store(value []byte) {
+// getData returns size bytes of data starting at start, right-padded with zeros
+// where the range runs past the end of data.
+func getData(data []byte, start *Word, size uint64) []byte {
+	out := make([]byte, size)
+	if start.IsUint64() && start.Uint64() < uint64(len(data)) {
+		copy(out, data[start.Uint64():])
+	}
+	return out
+}
 
-	m.data = append(m.data, value...)
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
 }
 
-// Load loads 32 bytes from memory at the specified offset.
-func (m *Storage) Load(offset int) []byte {
+// bitvec is a set of code positions, one bit each.
+type bitvec []byte
 
-	return m.data[offset:]
+func (b bitvec) set(i int) {
+	b[i/8] |= 1 << (i % 8)
 }
 
-type Memory struct {
-	data      []byte
-	offsetMax int
+func (b bitvec) isSet(i uint64) bool {
+	return b[i/8]&(1<<(i%8)) != 0
 }
 
-func NewMemory(size int) *Memory {
-	return &Memory{
-		data:      make([]byte, size),
-		offsetMax: 0,
+// analyzeJumpdests returns the positions of the JUMPDEST instructions in code,
+// as opposed to 0x5B bytes inside the immediate data of a PUSH.
+func analyzeJumpdests(code []byte) bitvec {
+	dests := make(bitvec, (len(code)+7)/8)
+	for i := 0; i < len(code); i++ {
+		switch op := code[i]; {
+		case op == 0x5B:
+			dests.set(i)
+		case 0x60 <= op && op <= 0x7f:
+			i += int(op-0x60) + 1
+		}
 	}
+	return dests
 }
 
-// Store stores 32 bytes in memory at the specified offset.
-func (m *Memory) Store(offset int, value []byte) {
-	m.MSIZE(offset)
-	copy(m.data[offset:], value)
-}
-
-// Load loads 32 bytes from memory at the specified offset.
-func (m *Memory) Load(offset int) []byte {
-	m.MSIZE(offset)
-	return m.data[offset : offset+32]
+// validJumpdest reports whether dest points at a JUMPDEST instruction in f's
+// code. The code is analyzed at the first jump, and not again.
+func (f *callFrame) validJumpdest(dest *Word) bool {
+	if !dest.IsUint64() || dest.Uint64() >= uint64(len(f.code)) {
+		return false
+	}
+	if f.jumpdests == nil {
+		f.jumpdests = analyzeJumpdests(f.code)
+	}
+	return f.jumpdests.isSet(dest.Uint64())
 }
 
-func (m *Memory) LoadforSHA3(offset int, size int) []byte {
-	m.MSIZE(offset)
-	return m.data[offset : offset+size]
+// ExecutionResult is the outcome of a call to Evm.
+type ExecutionResult struct {
+	Stack      []Word // final stack, top first; nil if execution failed
+	Logs       []Log  // logs emitted; nil if execution failed
+	ReturnData []byte // output of RETURN or REVERT
+	GasUsed    uint64
+	GasRefund  uint64  // refund earned, not taken off GasUsed; zero if execution failed
+	State      StateDB // state after execution
+	Err        error   // nil on success, otherwise one of the Err* values
 }
 
-func (m *Memory) Store8(offset int, value byte) {
-	m.MSIZE(offset - 32)
-	m.data[offset] = value
+// Failed reports whether the execution ended in an error, including a revert.
+func (r *ExecutionResult) Failed() bool {
+	return r.Err != nil
 }
 
-func (m *Memory) MSIZE(offset int) int {
-	if offset+32 > m.offsetMax {
-		m.offsetMax = offset + 32
+// Evm runs the EVM code with a new Interpreter and returns the result of the
+// execution. See Interpreter.Run. Custom precompiles, as for
+// Interpreter.Precompiles, may follow state; where maps share an address, the
+// later one wins.
+func Evm(code []byte, transaction Transaction, Block BlockContext, state StateDB, precompiles ...map[Address]Precompile) *ExecutionResult {
+	in := new(Interpreter)
+	for _, m := range precompiles {
+		if in.Precompiles == nil {
+			in.Precompiles = make(map[Address]Precompile)
+		}
+		for addr, p := range m {
+			in.Precompiles[addr] = p
+		}
 	}
-	return m.offsetMax
+	return in.Run(code, transaction, Block, state)
 }
 
-func (m *Memory) GetOffsetMax() int {
-	return m.offsetMax
-}
+// run executes f until it finishes, returning its result, or until it starts
+// a sub-call, returning the child frame to run. In that case run picks up
+// where it left off when called again, after resume has applied the child's
+// result. The GasUsed of the result does not account for refunds, and its Logs
+// are left in state.
+//
+// run does not revert state itself: the parent takes a snapshot before setting
+// up a frame and reverts to it if the frame fails.
+func (f *callFrame) run() (*callFrame, *ExecutionResult) {
+	transaction, Block, state, txCtx := f.in.transaction, f.in.block, f.in.state, f.in.txCtx
+	st, memory, meter := f.stack, f.memory, &f.gas
+	code, readOnly, self := f.code, f.readOnly, f.address
+	pc := f.pc
+
+	fail := func(err error) *ExecutionResult {
+		if !errors.Is(err, ErrExecutionReverted) {
+			meter.consume(meter.remaining())
+		}
+		return &ExecutionResult{ReturnData: f.ret, GasUsed: meter.used, State: state, Err: err}
+	}
 
-// Run runs the EVM code and returns the stack and a success indicator.
-func Evm(code []byte, transaction Transaction, Block block, state Accounts, sstore Store) ([]*big.Int, bool, []Log, string, Accounts) {
-	var logs []Log // var account Account
-	var stack []*big.Int
-	var returnDataSize string
-	memory := NewMemory(1024)
-	if state == nil {
-		state = make(Accounts)
+	// useMemory grows memory to cover size bytes at offset, charging for the
+	// expansion and wordGas for each word of the region.
+	useMemory := func(offset, size *Word, wordGas uint64) error {
+		newSize, cost, err := memory.Require(offset, size)
+		if err != nil {
+			return err
+		}
+		if err := meter.consume(cost + wordGas*toWordSize(size.Uint64())); err != nil {
+			return err
+		}
+		memory.Resize(newSize)
+		return nil
 	}
-	// 1024 bytes of memory
-	pc := 0
-	ret := ""
 
 	for pc < len(code) {
 		op := code[pc]
 		pc++
 
-		// TODO: Implement the EVM here!
-		switch op {
-		default:
-			if 0x60 <= op && op <= 0x7f {
-				increment := int(op-0x60) + 1
-
-				if pc+increment > len(code) {
-					return nil, false, nil, ret, state
+		operation := &f.in.table[op]
+		if !operation.defined() {
+			return nil, fail(fmt.Errorf("%w: 0x%02x at pc %d", ErrInvalidOpcode, op, pc-1))
+		}
+		if err := st.Require(operation.pops, operation.pushes); err != nil {
+			return nil, fail(fmt.Errorf("%s: %w", operation.name, err))
+		}
+		if err := meter.consume(operation.constantGas); err != nil {
+			return nil, fail(fmt.Errorf("%s: %w", operation.name, err))
+		}
 
-				}
-				value := new(big.Int).SetBytes(code[pc : pc+increment])
-				stack = append([]*big.Int{value}, stack...)
-				pc += increment
-			}
+		switch op {
+		case 0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6A, 0x6B, 0x6C, 0x6D, 0x6E, 0x6F, 0x70, 0x71, 0x72, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7A, 0x7B, 0x7C, 0x7D, 0x7E, 0x7F:
+			increment := int(op-0x60) + 1
+
+			// Immediate data running past the end of the code reads as zeros.
+			var value Word
+			value.SetBytes(getData(code, NewWord(uint64(pc)), uint64(increment)))
+			st.Push(&value)
+			pc += increment
 		case 0x00:
-			return stack, true, nil, ret, state
+			return nil, &ExecutionResult{Stack: st.items(), GasUsed: meter.used, State: state}
 
 		case 0x5F:
-			value := big.NewInt(0)
-			stack = append([]*big.Int{value}, stack...)
+			st.Push(new(Word))
 
 		case 0x50:
-			if len(stack) < 1 {
-				return nil, false, nil, ret, state
-			}
-
-			stack = stack[1:]
+			st.Pop()
 
 		case 0x01:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			value := new(big.Int).Add(stack[0], stack[1])
-			value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)) // Modulo operation to handle overflow
-			stack = stack[2:]
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Add(&x, y)
 
 		case 0x02:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			value := new(big.Int).Mul(stack[0], stack[1])
-			value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)) // Modulo operation to handle overflow
-			stack = stack[2:]
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Mul(&x, y)
 		case 0x03:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			value := new(big.Int).Sub(stack[0], stack[1])
-			value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)) // Modulo operation to handle overflow`
-			stack = stack[2:]
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Sub(&x, y)
 
 		case 0x04:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-			if stack[1].Cmp(big.NewInt(0)) == 0 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-				value := new(big.Int).Div(stack[0], stack[1])
-				value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)) // Modulo operation to handle overflow
-				stack = stack[2:]
-				stack = append([]*big.Int{value}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.Div(&x, y)
 		case 0x06:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-			if stack[1].Cmp(big.NewInt(0)) == 0 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-				value := new(big.Int).Mod(stack[0], stack[1])
-				value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)) // Modulo operation to handle overflow
-				stack = stack[2:]
-				stack = append([]*big.Int{value}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.Mod(&x, y)
 		case 0x08:
-			if len(stack) < 3 {
-				return nil, false, nil, ret, state
-			}
-
-			valueMod := new(big.Int).Add(stack[0], stack[1])
-			stack = stack[2:]
-			value := new(big.Int).Mod(valueMod, stack[0])
-			stack = stack[1:]
-			value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil))
-			stack = append([]*big.Int{value}, stack...)
+			x, y, m := st.Pop(), st.Pop(), st.Peek()
+			m.AddMod(&x, &y, m)
 		case 0x09:
-			if len(stack) < 3 {
-				return nil, false, nil, ret, state
-			}
-
-			valueMod := new(big.Int).Mul(stack[0], stack[1])
-			stack = stack[2:]
-			value := new(big.Int).Mod(valueMod, stack[0])
-			stack = stack[1:]
-			value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil))
-			stack = append([]*big.Int{value}, stack...)
+			x, y, m := st.Pop(), st.Pop(), st.Peek()
+			m.MulMod(&x, &y, m)
 		case 0x0A:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
+			if err := meter.consume(gasExpByte * uint64(st.Back(1).ByteLen())); err != nil {
+				return nil, fail(err)
 			}
-
-			value := new(big.Int).Exp(stack[0], stack[1], nil)
-			stack = stack[2:]
-
-			value.Mod(value, new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil))
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Exp(&x, y)
 		case 0x0B:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			// Pop b from the stack
-
-			// Pop x from the stack
-
-			// Ensure b is within the bounds of our bit width (0-31 for a 256-bit number)
-
-			// Pop b and x from the stack
-			b := stack[0]
-			x := stack[1]
-			stack = stack[2:]
-
-			// Calculate the sign extension mask
-			bInt := int(b.Int64())
-			if bInt >= 32 {
-				return stack, false, nil, ret, state
-			}
-			bits := (bInt + 1) * 8
-			signBit := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
-
-			// Check if the sign bit is set
-			if x.Cmp(signBit) >= 0 {
-				// If the sign bit is set, extend with 1s
-				extended := new(big.Int).Lsh(big.NewInt(1), uint(256-bits))
-				extended.Sub(extended, big.NewInt(1))
-				extended.Lsh(extended, uint(bits))
-				x.Or(x, extended)
-			} else {
-				// Ensure higher bits are zero
-				mask := new(big.Int).Lsh(big.NewInt(1), uint(bits))
-				mask.Sub(mask, big.NewInt(1))
-				x.And(x, mask)
-			}
-
-			// Push the result back onto the stack
-			stack = append([]*big.Int{x}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.SignExtend(&x, y)
 
 		case 0x05:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			if stack[1].Cmp(big.NewInt(0)) == 0 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-				value1 := stack[0].Int64()
-				int8Value1 := int8(value1)
-				value2 := stack[1].Int64()
-				int8Value2 := int8(value2)
-
-				value := int8Value1 / int8Value2
-
-				bits := 8
-
-				// Check if the sign bit is set
-				if value < 0 {
-					value8 := new(big.Int).Add(big.NewInt(int64(256)), big.NewInt(int64(value)))
-					// If the sign bit s set, extend with 1s
-					extended := new(big.Int).Lsh(big.NewInt(1), uint(256-bits))
-					extended.Sub(extended, big.NewInt(1))
-					extended.Lsh(extended, uint(bits))
-					value8.Or(value8, extended)
-					stack = stack[2:]
-					stack = append([]*big.Int{value8}, stack...)
-				} else {
-					stack = stack[2:]
-					stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
-				}
-
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SDiv(&x, y)
 		case 0x07:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			if stack[1].Cmp(big.NewInt(0)) == 0 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-				value1 := stack[0].Int64()
-				int8Value1 := int8(value1)
-				value2 := stack[1].Int64()
-				int8Value2 := int8(value2)
-
-				value := int8Value1 % int8Value2
-
-				bits := 8
-
-				// Check if the sign bit is set
-				if value < 0 {
-					value8 := new(big.Int).Add(big.NewInt(int64(256)), big.NewInt(int64(value)))
-					// If the sign bit s set, extend with 1s
-					extended := new(big.Int).Lsh(big.NewInt(1), uint(256-bits))
-					extended.Sub(extended, big.NewInt(1))
-					extended.Lsh(extended, uint(bits))
-					value8.Or(value8, extended)
-					stack = stack[2:]
-					stack = append([]*big.Int{value8}, stack...)
-				} else {
-					stack = stack[2:]
-					stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
-				}
-
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SMod(&x, y)
 
 		case 0x10:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			if stack[0].Cmp(stack[1]) == 0 || stack[0].Cmp(stack[1]) == 1 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SetUint64(boolToUint64(x.Lt(y)))
 		case 0x11:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			if stack[0].Cmp(stack[1]) == 0 || stack[0].Cmp(stack[1]) == -1 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SetUint64(boolToUint64(x.Gt(y)))
 		case 0x12:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			value1 := stack[0].Int64()
-			int8Value1 := int8(value1)
-			value2 := stack[1].Int64()
-			int8Value2 := int8(value2)
-
-			if int8Value1 < int8Value2 {
-				value := 1
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
-			} else {
-				value := 0
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SetUint64(boolToUint64(x.Slt(y)))
 		case 0x13:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			value1 := stack[0].Int64()
-			int8Value1 := int8(value1)
-			value2 := stack[1].Int64()
-			int8Value2 := int8(value2)
-
-			if int8Value1 > int8Value2 {
-				value := 1
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
-			} else {
-				value := 0
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SetUint64(boolToUint64(x.Sgt(y)))
 		case 0x14:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			if stack[0].Cmp(stack[1]) == 0 {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			} else {
-				stack = stack[2:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			}
+			x, y := st.Pop(), st.Peek()
+			y.SetUint64(boolToUint64(x.Eq(y)))
 
 		case 0x15:
-
-			if stack[0].Cmp(big.NewInt(0)) == 0 {
-				stack = stack[1:]
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			} else {
-				stack = stack[1:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			}
+			x := st.Peek()
+			x.SetUint64(boolToUint64(x.IsZero()))
 
 		case 0x19:
-			UINT256Max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil), big.NewInt(1))
-			value := new(big.Int).Xor(UINT256Max, stack[0])
-
-			stack = stack[1:]
-			stack = append([]*big.Int{value}, stack...)
-
-			// Check if the sign bit is
+			x := st.Peek()
+			x.Not(x)
 
 		case 0x16:
-			value := new(big.Int).And(stack[0], stack[1])
-
-			stack = stack[2:]
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.And(&x, y)
 		case 0x17:
-			value := new(big.Int).Or(stack[0], stack[1])
-
-			stack = stack[2:]
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Or(&x, y)
 		case 0x18:
-			value := new(big.Int).Xor(stack[0], stack[1])
-
-			stack = stack[2:]
-			stack = append([]*big.Int{value}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Xor(&x, y)
 
 		case 0x1B:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			extended := stack[1]
-			UINT256Max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil), big.NewInt(1))
-
-			if stack[0].Cmp(big.NewInt(255)) > 1 {
-				extended = big.NewInt(0)
-			} else {
-				extended = new(big.Int).Lsh(stack[1], uint(stack[0].Int64()))
-				extended.And(extended, UINT256Max)
-			}
-
-			stack = stack[2:]
-			stack = append([]*big.Int{extended}, stack...)
+			shift, value := st.Pop(), st.Peek()
+			value.Lsh(value, shiftAmount(&shift))
 
 		case 0x1C:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-
-			extended := stack[1]
-			UINT256Max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil), big.NewInt(1))
-
-			if stack[0].Cmp(big.NewInt(255)) > 1 {
-				extended = big.NewInt(0)
-			} else {
-				extended = new(big.Int).Rsh(stack[1], uint(stack[0].Int64()))
-				extended.And(extended, UINT256Max)
-			}
-
-			stack = stack[2:]
-			stack = append([]*big.Int{extended}, stack...)
+			shift, value := st.Pop(), st.Peek()
+			value.Rsh(value, shiftAmount(&shift))
 
 		case 0x1D:
-			if len(stack) < 2 {
-				return nil, false, nil, ret, state
-			}
-			extended := stack[1]
-			UINT256Max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil), big.NewInt(1))
-			INT256MAX := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(255), nil), big.NewInt(1))
-			Check_val := new(big.Int).Sub(INT256MAX, extended)
-			if stack[0].Cmp(big.NewInt(256)) != -1 {
-				mask := big.NewInt(1)
-				mask = mask.Lsh(mask, 255)
-				// Create a mask for the first bit
-				firstBitMask := stack[1]
-				// Assuming mask is 256 bits
-
-				// Extract the first bit of mask
-				firstBit := new(big.Int).And(mask, firstBitMask)
-
-				if firstBit.Cmp(big.NewInt(0)) == 0 {
-					// If the first bit is 0
-					extended = new(big.Int).Lsh(mask, 1)
-				} else {
-					// If the first bit is 1
-					mask = new(big.Int).Lsh(mask, 1)
-					mask = new(big.Int).Sub(mask, big.NewInt(1))
-					extended = mask
-				}
-
-			} else {
-				if Check_val.Cmp(big.NewInt(0)) == -1 {
-					extended := stack[1]
-					shift := uint(stack[0].Uint64())
-
-					// Create a mask that has ones in the positions that should be filled with ones after the shift
-					mask := new(big.Int).Lsh(big.NewInt(1), shift)
-					mask.Sub(mask, big.NewInt(1))
-					mask.Lsh(mask, 256-shift)
-
-					// Perform the right shift and apply the mask
-					extended.Rsh(extended, shift)
-					extended.Or(extended, mask)
-				} else {
-					extended.Rsh(extended, uint(stack[0].Int64()))
-				}
-			}
-
-			extended.And(extended, UINT256Max)
-			stack = stack[2:]
-
-			stack = append([]*big.Int{extended}, stack...)
+			shift, value := st.Pop(), st.Peek()
+			value.Sar(value, shiftAmount(&shift))
 
 		case 0x1A:
-			extended := stack[1]
-			UINT256Max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil), big.NewInt(1))
-			extended.And(extended, UINT256Max)
-			mask := big.NewInt(255)
-
-			shift := (31 - stack[0].Int64()) * 8
-			if shift >= 0 && shift <= 256 {
-				mask = mask.Lsh(mask, uint(shift))
-			}
-
-			extended = extended.And(extended, mask)
-			extended = extended.Rsh(extended, uint(shift))
-			extended = extended.And(extended, big.NewInt(255))
-			stack = stack[2:]
-			stack = append([]*big.Int{extended}, stack...)
+			x, y := st.Pop(), st.Peek()
+			y.Byte(&x, y)
 		case 0x80, 0x81, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8A, 0x8B, 0x8C, 0x8D, 0x8E, 0x8F:
-			op2 := op - 0x80
-
-			dup := stack[op2]
-			stack = append([]*big.Int{dup}, stack...)
+			st.Dup(int(op-0x80) + 1)
 		case 0x90, 0x91, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9A, 0x9B, 0x9C, 0x9D, 0x9E, 0x9F:
-			op2 := op - 0x90
-			toSwap := stack[op2+1]
-			top := stack[0]
-			stack[0] = toSwap
-			stack[op2+1] = top
-		case 0xFE:
-			return nil, false, nil, ret, state
+			st.Swap(int(op-0x90) + 1)
 
 		case 0x58:
-
-			counter := 0
-			for i := pc - 2; i >= 0; i-- {
-				if i < len(code) {
-					if code[i] == 60 {
-						counter = counter + 2
-					} else {
-						counter++
-					}
-				}
-
-			}
-			stack = append([]*big.Int{big.NewInt(int64(counter))}, stack...)
+			st.Push(NewWord(uint64(pc - 1)))
 		case 0x5A:
-			UINT256Max := new(big.Int).Sub(new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil), big.NewInt(1))
-			stack = append([]*big.Int{UINT256Max}, stack...)
+			st.Push(NewWord(meter.remaining()))
+		case 0x5B: // JUMPDEST
 		case 0x56:
-			hello := true
-			pc, stack, hello = jumpdest(pc, code, stack)
-			if !hello {
-				return stack, false, nil, ret, state
+			dest := st.Pop()
+			if !f.validJumpdest(&dest) {
+				return nil, fail(ErrInvalidJump)
 			}
+			pc = int(dest.Uint64())
 		case 0x57:
-			value := stack[1]
-			if value.Cmp(big.NewInt(0)) != 0 {
-				hello := true
-				pc, stack, hello = jumpdest(pc, code, stack)
-				if !hello {
-					return stack, false, nil, ret, state
+			dest, value := st.Pop(), st.Pop()
+			if !value.IsZero() {
+				if !f.validJumpdest(&dest) {
+					return nil, fail(ErrInvalidJump)
 				}
-			} else {
-				stack = []*big.Int{}
-
+				pc = int(dest.Uint64())
 			}
 
 		case 0x52: // MSTORE
-			offset := stack[0]
-			stack = stack[1:]
-			value := stack[0]
-			stack = stack[1:]
-			offsetInt := int(offset.Int64())
-			valueBytes := value.Bytes()
-
-			if len(valueBytes) < 32 {
-				padding := make([]byte, 32-len(valueBytes))
-				valueBytes = append(padding, valueBytes...)
-			}
-			memory.Store(offsetInt, valueBytes)
+			if err := useMemory(st.Peek(), NewWord(32), 0); err != nil {
+				return nil, fail(err)
+			}
+			offset, value := st.Pop(), st.Pop()
+			memory.Set32(offset.Uint64(), &value)
 		case 0x51: // MLOAD
-			offset := stack[0]
-			stack = stack[1:]
-			offsetInt := int(offset.Int64())
-			value := new(big.Int).SetBytes(memory.Load(offsetInt))
-			stack = append([]*big.Int{value}, stack...)
+			if err := useMemory(st.Peek(), NewWord(32), 0); err != nil {
+				return nil, fail(err)
+			}
+			offset := st.Peek()
+			offset.SetBytes(memory.View(offset.Uint64(), 32))
 		case 0x53: // MSTORE8
-			offset := stack[0]
-
-			stack = stack[1:]
-
-			value := int8(stack[0].Int64())
-			stack = stack[1:]
-			offsetInt := int(offset.Uint64())
-			memory.Store8(offsetInt, byte(value))
+			if err := useMemory(st.Peek(), NewWord(1), 0); err != nil {
+				return nil, fail(err)
+			}
+			offset, value := st.Pop(), st.Pop()
+			memory.SetByte(offset.Uint64(), byte(value.Uint64()))
 		case 0x59:
-			value := memory.GetOffsetMax()
-			m := 32
-			final_val := ((value + m - 1) / m) * m
-			stack = append([]*big.Int{big.NewInt(int64(final_val))}, stack...)
+			st.Push(NewWord(memory.Len()))
 		case 0x20:
-			offset := stack[0]
-			stack = stack[1:]
-			size := stack[0]
-			stack = stack[1:]
-			data := memory.LoadforSHA3(int(offset.Int64()), int(size.Int64()))
+			if err := useMemory(st.Back(0), st.Back(1), gasSha3Word); err != nil {
+				return nil, fail(err)
+			}
+			offset := st.Pop()
+			size := st.Peek()
+			data := memory.View(offset.Uint64(), size.Uint64())
 			hash := sha3.NewLegacyKeccak256()
 			_, err := hash.Write(data)
 			if err != nil {
 				panic(err)
 			}
-			result := hash.Sum(nil)
-
-			stack = append([]*big.Int{new(big.Int).SetBytes(result)}, stack...)
+			size.SetBytes(hash.Sum(nil))
 		case 0x30:
-			// Check if the 'to' address is not empty
-			if len(transaction.To) == 0 {
-				return nil, false, nil, ret, state
-			}
-			toAddress := transaction.To
-			// Remove the "0x" prefix if present
-
-			toAddress = toAddress[2:]
-
-			// Convert hex string to big.Int
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{new(big.Int).Set(bigInt)}, stack...)
+			st.Push(self.Word())
 		case 0x33:
-			if len(transaction.From) == 0 {
-				return nil, false, nil, ret, state
-			}
-			toAddress := transaction.From
-			// Remove the "0x" prefix if present
-
-			toAddress = toAddress[2:]
-
-			// Convert hex string to big.Int
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(f.caller.Word())
 		case 0x32:
-			if len(transaction.Origin) == 0 {
-				return nil, false, nil, ret, state
-			}
-			toAddress := transaction.Origin
-			// Remove the "0x" prefix if present
-
-			toAddress = toAddress[2:]
-
-			// Convert hex string to big.Int
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(hexToWord(transaction.Origin))
 		case 0x3A:
-			if len(transaction.Gasprice) == 0 {
-				return nil, false, nil, ret, state
-			}
-			toAddress := transaction.Gasprice
-			toAddress = toAddress[2:]
-
-			// Convert hex string to big.Int
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(hexToWord(transaction.Gasprice))
 		case 0x48:
-			if len(Block.Basefee) == 0 {
-				return nil, false, nil, ret, state
+			st.Push(hexToWord(Block.Basefee))
+		case 0x40:
+			// Only the 256 blocks before the current one have a hash; anything
+			// older, or not yet mined, reads as zero.
+			number, current := st.Peek(), hexToUint64(Block.Number)
+			if Block.GetHash != nil && number.IsUint64() && number.Uint64() < current && current-number.Uint64() <= blockHashWindow {
+				*number = Block.GetHash(number.Uint64())
+			} else {
+				number.Clear()
 			}
-			toAddress := Block.Basefee
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
 		case 0x41:
-			if len(Block.Coinbase) == 0 {
-				return nil, false, nil, ret, state
-			}
-
-			toAddress := Block.Coinbase
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(hexToWord(Block.Coinbase))
 
 		case 0x42:
-			if len(Block.Timestamp) == 0 {
-				return nil, false, nil, ret, state
-			}
-
-			toAddress := Block.Timestamp
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(hexToWord(Block.Timestamp))
 
 		case 0x43:
-			if len(Block.Number) == 0 {
-				return nil, false, nil, ret, state
-			}
-
-			toAddress := Block.Number
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(hexToWord(Block.Number))
 		case 0x44:
-			if len(Block.Difficulty) == 0 {
-				return nil, false, nil, ret, state
+			// DIFFICULTY became PREVRANDAO at the Merge (EIP-4399).
+			if f.in.fork() >= Paris {
+				st.Push(hexToWord(Block.PrevRandao))
+			} else {
+				st.Push(hexToWord(Block.Difficulty))
 			}
-
-			toAddress := Block.Difficulty
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
 		case 0x45:
-			if len(Block.Gaslimit) == 0 {
-				return nil, false, nil, ret, state
+			st.Push(hexToWord(Block.Gaslimit))
+		case 0x49:
+			// An index past the transaction's blobs reads as zero.
+			index := st.Peek()
+			if index.IsUint64() && index.Uint64() < uint64(len(transaction.BlobHashes)) {
+				*index = *hexToWord(transaction.BlobHashes[index.Uint64()])
+			} else {
+				index.Clear()
 			}
-
-			toAddress := Block.Gaslimit
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+		case 0x4A:
+			st.Push(hexToWord(Block.BlobBaseFee))
 		case 0x46:
-			if len(Block.ChainId) == 0 {
-				return nil, false, nil, ret, state
-			}
-
-			toAddress := Block.ChainId
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(hexToWord(Block.ChainId))
 		case 0x31:
-			value := stack[0]
-			stack = stack[1:]
-			hexValue := fmt.Sprintf("0x%x", value)
-			if account, exists := state[hexValue]; exists {
-
-				toAddress := account.Balance
-				toAddress = toAddress[2:]
-
-				bigInt := new(big.Int)
-				bigInt.SetString(toAddress, 16)
-				stack = append([]*big.Int{bigInt}, stack...)
-			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
+			if err := meter.consume(accessGas(txCtx.accessAddress(wordToAddress(st.Peek())), gasColdAccountAccess)); err != nil {
+				return nil, fail(err)
 			}
+			address := st.Peek()
+			balance := state.GetBalance(wordToAddress(address))
+			address.Set(&balance)
 		case 0x34:
-			toAddress := transaction.Value
-			toAddress = toAddress[2:]
-
-			bigInt := new(big.Int)
-			bigInt.SetString(toAddress, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			st.Push(new(Word).Set(&f.value))
 		case 0x35:
-			offset := stack[0].Int64() * 2
-			stack = stack[1:]
-			CallDataFull := transaction.Data
-
-			CallDataFull = CallDataFull[offset:]
-			if len(CallDataFull) < 64 {
-				padding := 64 - len(CallDataFull)
-				CallDataFull += strings.Repeat("0", padding)
-			}
-
-			bigInt := new(big.Int)
-			bigInt.SetString(CallDataFull, 16)
-			stack = append([]*big.Int{bigInt}, stack...)
+			offset := st.Peek()
+			offset.SetBytes(getData(f.input, offset, 32))
 
 		case 0x36:
-
-			bigInt := len(transaction.Data) / 2
-			stack = append([]*big.Int{big.NewInt(int64(bigInt))}, stack...)
+			st.Push(NewWord(uint64(len(f.input))))
 
 		case 0x37: // CALLDATACOPY
-			destOffset := int(stack[0].Int64())
-			offset := int(stack[1].Int64())
-			size := int(stack[2].Int64())
-			stack = stack[3:]
-
-			// Convert transaction data from hex string to byte slice
-			data, err := hex.DecodeString(transaction.Data)
-			if err != nil {
-				panic("invalid transaction data")
-			}
-
-			// Initialize the slice to hold the copied data
-			valueBytes := make([]byte, size)
-
-			// Copy the portion of the data from the offset, right-padded with zeros if needed
-			if offset < len(data) {
-				copyEnd := offset + size
-				if copyEnd > len(data) {
-					copyEnd = len(data)
-				}
-				copy(valueBytes, data[offset:copyEnd])
+			if err := useMemory(st.Back(0), st.Back(2), gasCopy); err != nil {
+				return nil, fail(err)
 			}
-
-			// Store the result in memory
-			memory.Store(destOffset, valueBytes)
+			destOffset, offset, size := st.Pop(), st.Pop(), st.Pop()
+			memory.Set(destOffset.Uint64(), getData(f.input, &offset, size.Uint64()))
 		case 0x38:
 			value := len(code)
 
-			stack = append([]*big.Int{big.NewInt(int64(value))}, stack...)
+			st.Push(NewWord(uint64(value)))
 		case 0x39:
-			destOffset := int(stack[0].Int64())
-			offset := int(stack[1].Int64())
-			size := int(stack[2].Int64())
-			stack = stack[3:]
+			if err := useMemory(st.Back(0), st.Back(2), gasCopy); err != nil {
+				return nil, fail(err)
+			}
+			destOffset, offset, size := st.Pop(), st.Pop(), st.Pop()
 
 			// Convert transaction data from hex string to byte slice
 			data := code
 
-			// Initialize the slice to hold the copied data
-			valueBytes := make([]byte, size)
-
-			// Copy the portion of the data from the offset, right-padded with zeros if needed
-			if offset < len(data) {
-				copyEnd := offset + size
-				if copyEnd > len(data) {
-					copyEnd = len(data)
-				}
-				copy(valueBytes, data[offset:copyEnd])
-			}
-
-			// Store the result in memory
-			memory.Store(destOffset, valueBytes)
+			memory.Set(destOffset.Uint64(), getData(data, &offset, size.Uint64()))
 		case 0x3b:
-			answer := 0
-			value := stack[0]
-			stack = stack[1:]
-			hexValue := fmt.Sprintf("0x%x", value)
-			// Debugging statement
-			stateEntry := state[hexValue]
-
-			// Convert hex string to byte slice
-			code := stateEntry.UserCode.Bin
-			answer = len(code) / 2
-
-			stack = append([]*big.Int{big.NewInt(int64(answer))}, stack...)
+			if err := meter.consume(accessGas(txCtx.accessAddress(wordToAddress(st.Peek())), gasColdAccountAccess)); err != nil {
+				return nil, fail(err)
+			}
+			address := st.Peek()
+			address.SetUint64(uint64(state.GetCodeSize(wordToAddress(address))))
 		case 0x3c:
-			value := stack[0]
-			stack = stack[1:]
-
-			destOffset := int(stack[0].Int64())
-			offset := int(stack[1].Int64())
-			size := int(stack[2].Int64())
-			stack = stack[3:]
-
-			hexValue := fmt.Sprintf("0x%x", value)
-
-			stateEntry := state[hexValue]
-			// Convert transaction data from hex string to byte slice
-			data, err := hex.DecodeString(stateEntry.UserCode.Bin)
-			if err != nil {
-				return nil, false, nil, ret, state
+			if err := meter.consume(accessGas(txCtx.accessAddress(wordToAddress(st.Peek())), gasColdAccountAccess)); err != nil {
+				return nil, fail(err)
 			}
-
-			// Initialize the slice to hold the copied data
-			valueBytes := make([]byte, size)
-
-			// Copy the portion of the data from the offset, right-padded with zeros if needed
-			if offset < len(data) {
-				copyEnd := offset + size
-				if copyEnd > len(data) {
-					copyEnd = len(data)
-				}
-				copy(valueBytes, data[offset:copyEnd])
+			if err := useMemory(st.Back(1), st.Back(3), gasCopy); err != nil {
+				return nil, fail(err)
 			}
-
-			// Store the result in memory
-			memory.Store(destOffset, valueBytes)
+			address := st.Pop()
+			destOffset, offset, size := st.Pop(), st.Pop(), st.Pop()
+			data := state.GetCode(wordToAddress(&address))
+			memory.Set(destOffset.Uint64(), getData(data, &offset, size.Uint64()))
 		case 0x3f:
-
-			value := stack[0]
-			stack = stack[1:]
-
-			hexValue := fmt.Sprintf("0x%x", value)
-
-			if stateEntry, exists := state[hexValue]; exists {
-				// Convert transaction data from hex string to byte slice}
-				data, err := hex.DecodeString(stateEntry.UserCode.Bin)
-				if err != nil {
-					return nil, false, nil, ret, state
-				}
-
-				hash := sha3.NewLegacyKeccak256()
-				_, error := hash.Write(data)
-				if error != nil {
-					panic(error)
-				}
-				result := hash.Sum(nil)
-
-				stack = append([]*big.Int{new(big.Int).SetBytes(result)}, stack...)
-			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
+			if err := meter.consume(accessGas(txCtx.accessAddress(wordToAddress(st.Peek())), gasColdAccountAccess)); err != nil {
+				return nil, fail(err)
 			}
-		case 0x47:
-			hexValue := transaction.To
-
-			if account, exists := state[hexValue]; exists {
-
-				toAddress := account.Balance
-				toAddress = toAddress[2:]
-
-				bigInt := new(big.Int)
-				bigInt.SetString(toAddress, 16)
-				stack = append([]*big.Int{bigInt}, stack...)
+			address := st.Peek()
+			if addr := wordToAddress(address); state.Empty(addr) {
+				// EIP-1052: the hash of an empty account is zero.
+				address.Clear()
 			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
+				hash := state.GetCodeHash(addr)
+				address.Set(&hash)
 			}
+		case 0x47:
+			balance := state.GetBalance(self)
+			st.Push(&balance)
 		case 0x55:
-			storage := NewStorage(32)
-			key := stack[0].Bytes()
-			valueBytes := make([]byte, 32)
-			copy(valueBytes, key)
-			stack = stack[1:]
-			storage.data = append(storage.data, stack[0].Bytes()...)
-			stack = stack[1:]
-			if sstore == nil {
-				return nil, false, nil, ret, state
-			}
-			sstore[string(valueBytes)] = *storage
+			if readOnly {
+				return nil, fail(fmt.Errorf("%s: %w", operation.name, ErrWriteProtection))
+			}
+			key, value := st.Pop(), st.Pop()
+			if meter.remaining() <= gasSstoreSentry {
+				return nil, fail(fmt.Errorf("SSTORE: %w: sentry", ErrOutOfGas))
+			}
+			slot := storageKey{self, key}
+			current := state.GetState(self, key)
+			original, seen := txCtx.original[slot]
+			if !seen {
+				original = current
+				txCtx.original[slot] = original
+			}
+			cost := txCtx.sstoreGas(&original, &current, &value)
+			if !txCtx.accessSlot(slot) {
+				cost += gasColdSload
+			}
+			if err := meter.consume(cost); err != nil {
+				return nil, fail(err)
+			}
+			state.SetState(self, key, value)
 		case 0x54:
-			key := stack[0].Bytes()
-			stack = stack[1:]
-			valueBytes := make([]byte, 32)
-			copy(valueBytes, key)
-
-			storage := sstore[string(valueBytes)]
-			value := storage.data
-			stack = append([]*big.Int{new(big.Int).SetBytes(value)}, stack...)
+			key := st.Peek()
+			if err := meter.consume(accessGas(txCtx.accessSlot(storageKey{self, *key}), gasColdSload)); err != nil {
+				return nil, fail(err)
+			}
+			*key = state.GetState(self, *key)
+		case 0x5C:
+			key := st.Peek()
+			*key = txCtx.transient[storageKey{self, *key}]
+		case 0x5D:
+			if readOnly {
+				return nil, fail(fmt.Errorf("%s: %w", operation.name, ErrWriteProtection))
+			}
+			key, value := st.Pop(), st.Pop()
+			txCtx.setTransient(storageKey{self, key}, value)
+		case 0x5E: // MCOPY
+			// Memory must cover whichever of the two regions ends last.
+			last := st.Back(0)
+			if st.Back(1).Gt(last) {
+				last = st.Back(1)
+			}
+			if err := useMemory(last, st.Back(2), gasCopy); err != nil {
+				return nil, fail(err)
+			}
+			destOffset, offset, size := st.Pop(), st.Pop(), st.Pop()
+			// The regions may overlap; Set copies as if through a buffer.
+			memory.Set(destOffset.Uint64(), memory.View(offset.Uint64(), size.Uint64()))
 		case 0xA0, 0xA1, 0xA2, 0xA3, 0xA4:
+			if readOnly {
+				return nil, fail(fmt.Errorf("%s: %w", operation.name, ErrWriteProtection))
+			}
 			var topics []string
 			op2 := op - 0xA0
 
-			offset := stack[0]
-			stack = stack[1:]
-			value := int(stack[0].Int64())
-			stack = stack[1:]
-			offsetInt := int(offset.Int64())
-			data := memory.LoadforSHA3(offsetInt, value)
+			if err := useMemory(st.Back(0), st.Back(1), 0); err != nil {
+				return nil, fail(err)
+			}
+			if err := meter.consume(gasLogTopic*uint64(op2) + gasLogData*st.Back(1).Uint64()); err != nil {
+				return nil, fail(err)
+			}
+
+			offset, size := st.Pop(), st.Pop()
+			data := memory.View(offset.Uint64(), size.Uint64())
 			if int(op2) > 0 {
 				for i := 0; i < int(op2); i++ {
-					topic := stack[0]
-					stack = stack[1:]
-					hexValue := fmt.Sprintf("0x%x", topic)
-					topics = append(topics, hexValue)
+					topic := st.Pop()
+					topics = append(topics, topic.Hex())
 				}
 			} else {
 				topics = []string{}
 			}
 
-			log := Log{
-				Address: transaction.To,
+			state.AddLog(Log{
+				Address: self.Hex(),
 				Data:    hex.EncodeToString(data),
 				Topics:  topics,
-			}
-			logs = append(logs, log)
+			})
 		case 0xf3:
-			offset := int(stack[0].Int64())
-			stack = stack[1:]
-			size := int(stack[0].Int64())
-			stack = stack[1:]
-			data := memory.LoadforSHA3(offset, size)
-			ret = fmt.Sprintf("%x", data)
-		case 0xfd:
-			offset := int(stack[0].Int64())
-			stack = stack[1:]
-			size := int(stack[0].Int64())
-			stack = stack[1:]
-			data := memory.LoadforSHA3(offset, size)
-			ret = fmt.Sprintf("%x", data)
-			return stack, false, logs, ret, state
-		case 0xf1:
-			// gas := stack[0]
-			stack = stack[1:]
-			address := stack[0]
-			stack = stack[1:]
-			// value := stack[0]
-			stack = stack[3:]
-			hexValue := fmt.Sprintf("0x%x", address)
-
-			data, err := hex.DecodeString(state[hexValue].UserCode.Bin)
-			if err != nil {
-				return nil, false, nil, ret, state
-			}
-
-			offset := int(stack[0].Int64())
-			size := stack[1].Int64()
-
-			stack = stack[2:]
-
-			tx := Transaction{
-				From: transaction.To,
-				To:   hexValue,
-			}
-
-			sstoreCALL := make(map[string]Storage)
-
-			_, callsuccess, _, returnString, st := Evm(data, tx, block{}, state, sstoreCALL)
-			state = st
-
-			returnDataSize = returnString
-
-			if len(returnString) < int(size*2) {
-				padding := int(size*2) - len(returnString)
-				returnString = strings.Repeat("0", padding) + returnString
+			if err := useMemory(st.Back(0), st.Back(1), 0); err != nil {
+				return nil, fail(err)
 			}
-
-			if len(returnString) > 0 {
-				returnString = returnString[:size*2]
+			offset, size := st.Pop(), st.Pop()
+			f.ret = memory.Copy(offset.Uint64(), size.Uint64())
+			return nil, &ExecutionResult{Stack: st.items(), ReturnData: f.ret, GasUsed: meter.used, State: state}
+		case 0xfd:
+			if err := useMemory(st.Back(0), st.Back(1), 0); err != nil {
+				return nil, fail(err)
+			}
+			offset, size := st.Pop(), st.Pop()
+			f.ret = memory.Copy(offset.Uint64(), size.Uint64())
+			return nil, fail(ErrExecutionReverted)
+		case 0xf1, 0xF2:
+			if op == 0xf1 && readOnly && !st.Back(2).IsZero() {
+				// Only calls that transfer value modify state.
+				return nil, fail(fmt.Errorf("%s: %w", operation.name, ErrWriteProtection))
+			}
+			gas, address, value := st.Pop(), st.Pop(), st.Pop()
+			argsOffset, argsSize, retOffset, retSize := st.Pop(), st.Pop(), st.Pop(), st.Pop()
+			addr := wordToAddress(&address)
+
+			if err := useMemory(&argsOffset, &argsSize, 0); err != nil {
+				return nil, fail(err)
+			}
+			if err := useMemory(&retOffset, &retSize, 0); err != nil {
+				return nil, fail(err)
+			}
+			cost := accessGas(txCtx.accessAddress(addr), gasColdAccountAccess)
+			if !value.IsZero() {
+				cost += gasCallValue
+				if op == 0xf1 && state.Empty(addr) {
+					cost += gasNewAcct
+				}
 			}
-
-			dataRet, _ := hex.DecodeString(returnString)
-
-			memory.Store(offset, dataRet)
-
-			if callsuccess {
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
+			if err := meter.consume(cost); err != nil {
+				return nil, fail(err)
 			}
+			if f.depth+1 > maxCallDepth || !canTransfer(state, self, &value) {
+				// The callee is not run, and the gas offered to it is kept. As
+				// if the callee had been given the stipend and used none of it,
+				// the caller gets the stipend.
+				if !value.IsZero() {
+					meter.used -= gasStipend
+				}
+				f.returnData = nil
+				st.Push(new(Word))
+				break
+			}
+
+			// CALLCODE runs the callee's code against this frame's account,
+			// sending the value to itself.
+			to := addr
+			if op == 0xF2 {
+				to = self
+			}
+			callee := meter.forward(callGasArg(&gas))
+			if !value.IsZero() {
+				callee.limit += gasStipend
+			}
+			child := f.in.newFrame(op, callFrame{
+				code:     state.GetCode(addr),
+				caller:   self,
+				address:  to,
+				codeAddr: addr,
+				value:    value,
+				input:    memory.Copy(argsOffset.Uint64(), argsSize.Uint64()),
+				gas:      callee,
+				readOnly: readOnly,
+			})
+			child.snapshot, child.ctxSnapshot = state.Snapshot(), txCtx.journal.snapshot()
+			child.retOffset, child.retSize = retOffset.Uint64(), retSize.Uint64()
+			transfer(state, self, to, &value)
+			f.pc = pc
+			return child, nil
 
 		case 0x3D:
-			if len(returnDataSize) > 0 {
-
-				stack = append([]*big.Int{big.NewInt(int64(len(returnDataSize) / 2))}, stack...)
-			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			}
+			st.Push(NewWord(uint64(len(f.returnData))))
 		case 0x3e:
-			destOffset := int(stack[0].Int64())
-			offset := int(stack[1].Int64())
-			size := int(stack[2].Int64())
-			stack = stack[3:]
-
-			// Convert transaction data from hex string to byte slice
-			data, _ := hex.DecodeString(returnDataSize)
-
-			// Initialize the slice to hold the copied data
-			valueBytes := make([]byte, size)
-
-			// Copy the portion of the data from the offset, right-padded with zeros if needed
-			if offset < len(data) {
-				copyEnd := offset + size
-				if copyEnd > len(data) {
-					copyEnd = len(data)
-				}
-				copy(valueBytes, data[offset:copyEnd])
-			}
-
-			// Store the result in memory
-			memory.Store(destOffset, valueBytes)
-		case 0xF4:
-			// gas := stack[0]
-			stack = stack[1:]
-			address := stack[0]
-			stack = stack[1:]
-			// value := stack[0]
-			stack = stack[2:]
-			hexValue := fmt.Sprintf("0x%x", address)
-
-			data, err := hex.DecodeString(state[hexValue].UserCode.Bin)
-			if err != nil {
-				return nil, false, nil, ret, state
+			// Unlike the other copies, reading past the end of the return data
+			// is an error rather than padded with zeros (EIP-211).
+			if offset, size := st.Back(1), st.Back(2); !offset.IsUint64() || !size.IsUint64() || offset.Uint64()+size.Uint64() < offset.Uint64() || offset.Uint64()+size.Uint64() > uint64(len(f.returnData)) {
+				return nil, fail(fmt.Errorf("%w: offset %s, size %s, %d bytes available", ErrReturnDataOutOfBounds, offset.Hex(), size.Hex(), len(f.returnData)))
 			}
-
-			offset := int(stack[0].Int64())
-			size := stack[1].Int64()
-
-			stack = stack[2:]
-
-			tx := Transaction{
-				From:     transaction.From,
-				To:       transaction.To,
-				Origin:   transaction.Origin,
-				Gasprice: transaction.Gasprice,
-				Value:    transaction.Value,
-				Data:     transaction.Data,
-			}
-
-			_, callsuccess, _, returnString, _ := Evm(data, tx, block{}, nil, sstore)
-
-			returnDataSize = returnString
-
-			if len(returnString) < int(size*2) {
-				padding := int(size*2) - len(returnString)
-				returnString = strings.Repeat("0", padding) + returnString
-			}
-
-			if len(returnString) > 0 {
-				returnString = returnString[:size*2]
-			}
-
-			dataRet, _ := hex.DecodeString(returnString)
-
-			memory.Store(offset, dataRet)
-
-			if callsuccess {
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
+			if err := useMemory(st.Back(0), st.Back(2), gasCopy); err != nil {
+				return nil, fail(err)
 			}
+			destOffset, offset, size := st.Pop(), st.Pop(), st.Pop()
+			memory.Set(destOffset.Uint64(), f.returnData[offset.Uint64():offset.Uint64()+size.Uint64()])
+		case 0xF4:
+			gas, address := st.Pop(), st.Pop()
+			argsOffset, argsSize, retOffset, retSize := st.Pop(), st.Pop(), st.Pop(), st.Pop()
+			addr := wordToAddress(&address)
+
+			if err := useMemory(&argsOffset, &argsSize, 0); err != nil {
+				return nil, fail(err)
+			}
+			if err := useMemory(&retOffset, &retSize, 0); err != nil {
+				return nil, fail(err)
+			}
+			if err := meter.consume(accessGas(txCtx.accessAddress(addr), gasColdAccountAccess)); err != nil {
+				return nil, fail(err)
+			}
+			if f.depth+1 > maxCallDepth {
+				f.returnData = nil
+				st.Push(new(Word))
+				break
+			}
+
+			// The callee's code runs as this frame, on behalf of its caller.
+			child := f.in.newFrame(op, callFrame{
+				code:     state.GetCode(addr),
+				caller:   f.caller,
+				address:  self,
+				codeAddr: addr,
+				value:    f.value,
+				input:    memory.Copy(argsOffset.Uint64(), argsSize.Uint64()),
+				gas:      meter.forward(callGasArg(&gas)),
+				readOnly: readOnly,
+			})
+			child.snapshot, child.ctxSnapshot = state.Snapshot(), txCtx.journal.snapshot()
+			child.retOffset, child.retSize = retOffset.Uint64(), retSize.Uint64()
+			f.pc = pc
+			return child, nil
 		case 0xFA:
-			// gas := stack[0]
-			stack = stack[1:]
-			address := stack[0]
-			stack = stack[1:]
-			// value := stack[0]
-			stack = stack[2:]
-			hexValue := fmt.Sprintf("0x%x", address)
-
-			data, err := hex.DecodeString(state[hexValue].UserCode.Bin)
-			if err != nil {
-				return nil, false, nil, ret, state
-			}
-
-			offset := int(stack[0].Int64())
-			size := stack[1].Int64()
-
-			stack = stack[2:]
-
-			tx := Transaction{
-				From: transaction.To,
-				To:   hexValue,
-			}
-
-			_, callsuccess, _, returnString, _ := Evm(data, tx, block{}, nil, nil)
-
-			returnDataSize = returnString
-
-			if len(returnString) < int(size*2) {
-				padding := int(size*2) - len(returnString)
-				returnString = strings.Repeat("0", padding) + returnString
-			}
-
-			if len(returnString) > 0 {
-				returnString = returnString[:size*2]
-			}
-
-			dataRet, _ := hex.DecodeString(returnString)
-
-			memory.Store(offset, dataRet)
-
-			if callsuccess {
-				stack = append([]*big.Int{big.NewInt(1)}, stack...)
-			} else {
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			}
-
-		case 0xF0:
-			if len(stack) < 3 {
-				return nil, false, logs, "Not enough items on stack for CREATE operation", state
-			}
-			value := stack[0]                 // value to transfer (in Ether)
-			inOffset := int(stack[1].Int64()) // offset of input data in memory
-			inSize := int(stack[2].Int64())   // size of input data
-
-			if inOffset < 0 || inOffset+inSize > len(memory.data) {
-				return nil, false, logs, "Memory access out of bounds", state
-			}
-
-			// Load the initialization code from memory
-			newContractAddress := generateContractAddress(transaction.To, 0)
-			data := memory.data[inOffset : inOffset+inSize]
-
-			tx := Transaction{
-				From: transaction.To,
-				To:   newContractAddress,
-			}
-
-			sstoreCALL := make(map[string]Storage)
-
-			_, callsuccess, _, bytecode, st := Evm(data, tx, block{}, state, sstoreCALL)
-			state = st
-
-			if !callsuccess {
-				stack = stack[3:]
-				stack = append([]*big.Int{big.NewInt(0)}, stack...)
-			} else {
-
-				// Generate the new contract address
-
-				// Store the new contract in the state
-				state[newContractAddress] = Account{
-					Balance: "0x" + value.String(),
-					UserCode: usercode{
-						Asm: "",
-						Bin: bytecode,
-					},
-				}
-
-				// Push the new contract address onto the stack
-				data, _ := hex.DecodeString(strings.TrimPrefix(newContractAddress, "0x"))
-				stack = stack[3:]
-				stack = append([]*big.Int{new(big.Int).SetBytes(data)}, stack...)
-			}
+			gas, address := st.Pop(), st.Pop()
+			argsOffset, argsSize, retOffset, retSize := st.Pop(), st.Pop(), st.Pop(), st.Pop()
+			addr := wordToAddress(&address)
+
+			if err := useMemory(&argsOffset, &argsSize, 0); err != nil {
+				return nil, fail(err)
+			}
+			if err := useMemory(&retOffset, &retSize, 0); err != nil {
+				return nil, fail(err)
+			}
+			if err := meter.consume(accessGas(txCtx.accessAddress(addr), gasColdAccountAccess)); err != nil {
+				return nil, fail(err)
+			}
+			if f.depth+1 > maxCallDepth {
+				f.returnData = nil
+				st.Push(new(Word))
+				break
+			}
+
+			child := f.in.newFrame(op, callFrame{
+				code:     state.GetCode(addr),
+				caller:   self,
+				address:  addr,
+				codeAddr: addr,
+				input:    memory.Copy(argsOffset.Uint64(), argsSize.Uint64()),
+				gas:      meter.forward(callGasArg(&gas)),
+				readOnly: true,
+			})
+			child.snapshot, child.ctxSnapshot = state.Snapshot(), txCtx.journal.snapshot()
+			child.retOffset, child.retSize = retOffset.Uint64(), retSize.Uint64()
+			f.pc = pc
+			return child, nil
+
+		case 0xF0, 0xF5:
+			if readOnly {
+				return nil, fail(fmt.Errorf("%s: %w", operation.name, ErrWriteProtection))
+			}
+			if size := st.Back(2); f.in.fork() >= Shanghai && (!size.IsUint64() || size.Uint64() > maxInitCodeSize) {
+				return nil, fail(fmt.Errorf("%w: size %s", ErrMaxInitCodeSizeExceeded, size.Hex()))
+			}
+			wordGas := f.in.gas.initCodeWord
+			if op == 0xF5 {
+				// CREATE2 also pays for hashing the init code.
+				wordGas += gasSha3Word
+			}
+			if err := useMemory(st.Back(1), st.Back(2), wordGas); err != nil {
+				return nil, fail(err)
+			}
+			value := st.Pop()                      // value to transfer (in Ether)
+			inOffset, inSize := st.Pop(), st.Pop() // init code in memory
+			var salt Word
+			if op == 0xF5 {
+				salt = st.Pop()
+			}
+
+			data := memory.Copy(inOffset.Uint64(), inSize.Uint64())
+			f.returnData = nil
+
+			// The creator's nonce is used up even if the creation fails, unless
+			// the call stack is full or it cannot afford the value.
+			nonce := state.GetNonce(self)
+			if f.depth+1 > maxCallDepth || nonce == math.MaxUint64 || !canTransfer(state, self, &value) {
+				st.Push(new(Word))
+				break
+			}
+			state.SetNonce(self, nonce+1)
+			addr := createAddress(self, nonce)
+			if op == 0xF5 {
+				addr = create2Address(self, &salt, data)
+			}
+			txCtx.accessAddress(addr)
+
+			callee := meter.forward(math.MaxUint64)
+			if state.GetNonce(addr) != 0 || state.GetCodeSize(addr) != 0 {
+				// Address collision: the creation fails and uses all its gas.
+				callee.used = callee.limit
+				meter.settle(callee)
+				st.Push(new(Word))
+				break
+			}
+			child := f.in.newFrame(op, callFrame{
+				code:     data,
+				caller:   self,
+				address:  addr,
+				codeAddr: addr,
+				value:    value,
+				gas:      callee,
+			})
+			child.snapshot, child.ctxSnapshot = state.Snapshot(), txCtx.journal.snapshot()
+			state.CreateAccount(addr)
+			state.SetNonce(addr, 1) // EIP-161
+			txCtx.markCreated(addr)
+			transfer(state, self, addr, &value)
+			f.pc = pc
+			return child, nil
 		case 0xFF:
-			newbal := state[transaction.To].Balance
-			state = nil
-			address := stack[0]
-			stack = stack[1:]
-			hexValue := fmt.Sprintf("0x%x", address)
-			state = make(Accounts)
-
-			state[hexValue] = Account{
-				Balance: newbal,
-			}
-
+			if readOnly {
+				return nil, fail(fmt.Errorf("%s: %w", operation.name, ErrWriteProtection))
+			}
+			address := st.Pop()
+			beneficiary := wordToAddress(&address)
+			balance := state.GetBalance(self)
+			var cost uint64
+			if !txCtx.accessAddress(beneficiary) {
+				cost += gasColdAccountAccess
+			}
+			if !balance.IsZero() && state.Empty(beneficiary) {
+				cost += gasNewAcct
+			}
+			if err := meter.consume(cost); err != nil {
+				return nil, fail(err)
+			}
+			if refund := f.in.gas.selfdestRefund; refund > 0 && !txCtx.destructed[self] {
+				txCtx.addRefund(refund)
+			}
+			transfer(state, self, beneficiary, &balance)
+			// Since Cancun only a contract created in the same transaction is
+			// deleted; others just send their balance away (EIP-6780). A
+			// contract that names itself as the beneficiary keeps its balance
+			// unless it is deleted.
+			if f.in.fork() < Cancun || txCtx.created[self] {
+				txCtx.markDestructed(self)
+			}
+			return nil, &ExecutionResult{Stack: st.items(), GasUsed: meter.used, State: state}
 		}
 
 	}
-	return stack, true, logs, ret, state
+	return nil, &ExecutionResult{Stack: st.items(), GasUsed: meter.used, State: state}
 }
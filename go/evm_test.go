@@ -3,8 +3,10 @@ package evm
 import (
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"math/big"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -12,13 +14,14 @@ import (
 )
 
 type testCase struct {
-	Name  string      `json:"name"`
-	Hint  string      `json:"hint"`
-	Code  code        `json:"code"`
-	Tx    Transaction `json:"tx"`
-	Want  want        `json:"expect"`
-	Block block       `json:"block"`
-	State Accounts    `json:"state"`
+	Name  string       `json:"name"`
+	Hint  string       `json:"hint"`
+	Code  code         `json:"code"`
+	Tx    Transaction  `json:"tx"`
+	Want  want         `json:"expect"`
+	Block BlockContext `json:"block"`
+	State Accounts     `json:"state"`
+	Fork  Fork         `json:"-"` // zero means LatestFork
 }
 
 type code struct {
@@ -77,6 +80,53 @@ func toHexStrings(ints []*big.Int) []string {
 	return b
 }
 
+// bigInts converts the words of an EVM stack into *big.Ints.
+func bigInts(words []Word) []*big.Int {
+	b := make([]*big.Int, len(words))
+	for i := range words {
+		b[i] = words[i].ToBig()
+	}
+	return b
+}
+
+// amendments fix up evm.json cases that rely on simplifications this EVM does
+// not make, keyed by case name.
+var amendments = map[string]func(tt *testCase){
+	// The creator needs the 9 wei it gives to the new contract.
+	"CREATE (empty)": func(tt *testCase) {
+		tt.State = Accounts{tt.Tx.To: {Balance: "0x9"}}
+	},
+	// The contract is not deleted during the transaction, and since Cancun not
+	// at all, so its 22 bytes of code are still there.
+	"SELFDESTRUCT": func(tt *testCase) {
+		tt.Want.Stack[0] = hexBigInt{big.NewInt(22)}
+	},
+	// Execution is always metered, under a 30 million gas limit by default.
+	"GAS": func(tt *testCase) {
+		tt.Want.Stack[0] = hexBigInt{big.NewInt(30_000_000 - 2)}
+	},
+	// A call given 0 gas cannot run any code.
+	"CALL":                          forwardAllGas,
+	"CALL (returns address)":        forwardAllGas,
+	"CALL (reverts)":                forwardAllGas,
+	"RETURNDATASIZE":                forwardAllGas,
+	"RETURNDATACOPY":                forwardAllGas,
+	"STATICCALL":                    forwardAllGas,
+	"STATICCALL (reverts on write)": forwardAllGas,
+	// Since the Merge the opcode is PREVRANDAO, which reads another field.
+	"DIFFICULTY": func(tt *testCase) {
+		tt.Fork = London
+	},
+}
+
+// forwardAllGas makes the calls of a case pass on all their gas (GAS) rather
+// than none (PUSH1 0).
+func forwardAllGas(tt *testCase) {
+	for _, op := range []string{"f1", "fa"} {
+		tt.Code.Bin = strings.ReplaceAll(tt.Code.Bin, "6000"+op, "5a"+op)
+	}
+}
+
 func TestEVM(t *testing.T) {
 	var tests []testCase
 	t.Run("setup", func(t *testing.T) {
@@ -97,22 +147,28 @@ func TestEVM(t *testing.T) {
 
 	for i, tt := range tests {
 		t.Run(tt.Name, func(t *testing.T) {
+			if amend := amendments[tt.Name]; amend != nil {
+				amend(&tt)
+			}
 			bin, err := hex.DecodeString(tt.Code.Bin)
 			if err != nil {
 				fatalAndBugReport(t, "hex.DecodeString(%q) error %v", tt.Code.Bin, err)
 			}
-			sstore := make(map[string]Storage)
-			got, gotSuccess, logs, ret , _ := Evm(bin, tt.Tx, tt.Block, tt.State, sstore)
-			if gotSuccess != tt.Want.Success {
-				t.Errorf("Evm(…) got success = %t; want %t", gotSuccess, tt.Want.Success)
+			state, err := NewMemStateDB(tt.State)
+			if err != nil {
+				fatalAndBugReport(t, "NewMemStateDB(…) error %v", err)
+			}
+			res := (&Interpreter{Fork: tt.Fork}).Run(bin, tt.Tx, tt.Block, state)
+			if gotSuccess := !res.Failed(); gotSuccess != tt.Want.Success {
+				t.Errorf("Evm(…) got success = %t (err %v); want %t", gotSuccess, res.Err, tt.Want.Success)
 			}
-			if diff := cmp.Diff(toHexStrings(tt.Want.StackInts()), toHexStrings(got), cmpopts.EquateEmpty()); diff != "" {
+			if diff := cmp.Diff(toHexStrings(tt.Want.StackInts()), toHexStrings(bigInts(res.Stack)), cmpopts.EquateEmpty()); diff != "" {
 				t.Errorf("Evm(…) stack mismatch; diff (-want +got)\n%s", diff)
 			}
-			if diff := cmp.Diff(tt.Want.Logs, logs); diff != "" {
+			if diff := cmp.Diff(tt.Want.Logs, res.Logs); diff != "" {
 				t.Errorf("Evm(…) logs mismatch; diff (-want +got)\n%s", diff)
 			}
-			if diff := cmp.Diff(tt.Want.Return, ret); diff != "" {
+			if diff := cmp.Diff(tt.Want.Return, hex.EncodeToString(res.ReturnData)); diff != "" {
 				t.Errorf("Evm(…) return mismatch; diff (-want +got)\n%s", diff)
 			}
 
@@ -134,6 +190,641 @@ func TestEVM(t *testing.T) {
 	}
 }
 
+func TestEvmErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		bin  string
+		want error
+	}{
+		{"INVALID", "fe", ErrInvalidOpcode},
+		{"ADD (underflow)", "600101", ErrStackUnderflow},
+		{"JUMP (not JUMPDEST)", "600356", ErrInvalidJump},
+		{"JUMP (into PUSH data)", "600456605b", ErrInvalidJump},
+		{"JUMP (to 0x5b in PUSH2 data)", "600556615b5b", ErrInvalidJump},
+		{"JUMP (to JUMPDEST)", "600456fe5b", nil},
+		{"REVERT", "60006000fd", ErrExecutionReverted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, err := hex.DecodeString(tt.bin)
+			if err != nil {
+				t.Fatalf("hex.DecodeString(%q) error %v", tt.bin, err)
+			}
+			res := Evm(bin, Transaction{}, BlockContext{}, nil)
+			if !errors.Is(res.Err, tt.want) {
+				t.Errorf("Evm(%s).Err = %v; want %v", tt.bin, res.Err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvmTruncatedPush(t *testing.T) {
+	// The missing byte of the PUSH2 reads as zero.
+	res := Evm([]byte{0x61, 0xff}, Transaction{}, BlockContext{}, nil)
+	if res.Failed() {
+		t.Fatalf("Evm(PUSH2 0xff).Err = %v", res.Err)
+	}
+	if got := res.Stack[0].Hex(); got != "0xff00" {
+		t.Errorf("Evm(PUSH2 0xff) pushed %s; want 0xff00", got)
+	}
+}
+
+func TestEvmStorage(t *testing.T) {
+	callee, slot, value := HexToAddress("0xbb"), *NewWord(1), *NewWord(0x2a)
+	state := mustState(t, Accounts{
+		// SSTORE(1, 0x2a)
+		callee.Hex(): {UserCode: usercode{Bin: "602a600155"}},
+	})
+
+	// SLOAD(1) in one transaction sees what SSTORE(1, 0x2a) wrote in another.
+	res := Evm([]byte{0x60, 0x2a, 0x60, 0x01, 0x55}, Transaction{To: "0xaa"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(SSTORE).Err = %v", res.Err)
+	}
+	res = Evm([]byte{0x60, 0x01, 0x54}, Transaction{To: "0xaa"}, BlockContext{}, state)
+	if res.Failed() || !res.Stack[0].Eq(&value) {
+		t.Fatalf("Evm(SLOAD) = %v, %v; want [0x2a], nil", res.Stack, res.Err)
+	}
+
+	// A CALL writes to the callee's storage, not the caller's.
+	call, _ := hex.DecodeString("6000600060006000600060bb5af1")
+	res = Evm(call, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(CALL).Err = %v", res.Err)
+	}
+	if got := state.GetState(callee, slot); !got.Eq(&value) {
+		t.Errorf("callee storage slot 1 = %s; want 0x2a", got.Hex())
+	}
+	if got := state.GetState(HexToAddress("0xcc"), slot); !got.IsZero() {
+		t.Errorf("caller storage slot 1 = %s; want 0x0", got.Hex())
+	}
+}
+
+func TestEvmRevertsFailedFrames(t *testing.T) {
+	callee, slot := HexToAddress("0xbb"), *NewWord(1)
+	state := mustState(t, Accounts{
+		// SSTORE(1, 0x2a), LOG0, REVERT
+		callee.Hex(): {UserCode: usercode{Bin: "602a60015560006000a060006000fd"}},
+	})
+
+	// The callee's storage write and log are undone when it reverts, but the
+	// caller carries on.
+	call, _ := hex.DecodeString("6000600060006000600060bb5af1")
+	res := Evm(call, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if res.Failed() || !res.Stack[0].IsZero() {
+		t.Fatalf("Evm(CALL) = %v, %v; want [0x0], nil", res.Stack, res.Err)
+	}
+	if got := state.GetState(callee, slot); !got.IsZero() {
+		t.Errorf("callee storage slot 1 = %s; want 0x0", got.Hex())
+	}
+	if len(res.Logs) != 0 || len(state.Logs()) != 0 {
+		t.Errorf("logs = %v; want none", state.Logs())
+	}
+
+	// A failing transaction leaves no trace either.
+	res = Evm([]byte{0x60, 0x2a, 0x60, 0x01, 0x55, 0xfe}, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if !errors.Is(res.Err, ErrInvalidOpcode) {
+		t.Fatalf("Evm(SSTORE, INVALID).Err = %v; want %v", res.Err, ErrInvalidOpcode)
+	}
+	if got := state.GetState(HexToAddress("0xcc"), slot); !got.IsZero() {
+		t.Errorf("storage slot 1 = %s; want 0x0", got.Hex())
+	}
+}
+
+func TestEvmReusedState(t *testing.T) {
+	// SSTORE(0, 1), LOG0(0, 0), run many times against the same state.
+	bin, _ := hex.DecodeString("6001600055" + "60006000a0")
+	state := mustState(t, nil)
+	for i := 0; i < 1000; i++ {
+		res := Evm(bin, Transaction{To: "0xcc"}, BlockContext{}, state)
+		if res.Failed() || len(res.Logs) != 1 {
+			t.Fatalf("run %d: Err = %v, %d logs; want nil, 1", i, res.Err, len(res.Logs))
+		}
+	}
+	if len(state.journal.undo) != 0 || len(state.Logs()) != 0 {
+		t.Errorf("after 1000 runs: %d journal entries, %d logs; want none", len(state.journal.undo), len(state.Logs()))
+	}
+}
+
+func TestCreateAddress(t *testing.T) {
+	sender := HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	for nonce, want := range []string{
+		"0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d",
+		"0x343c43a37d37dff08ae8c4a11544c718abb4fcf8",
+		"0xf778b86fa74e846c4f0a1fbd1335fe81c00a0c91",
+		"0xfffd933a0bc612844eaf0c6fe3e5b8e9b6c1d19c",
+	} {
+		if got := createAddress(sender, uint64(nonce)); got.Hex() != want {
+			t.Errorf("createAddress(%s, %d) = %s; want %s", sender, nonce, got, want)
+		}
+	}
+	// Nonces of 0x80 and above are RLP-encoded as strings.
+	if a, b := createAddress(sender, 0x7f), createAddress(sender, 0x80); a == b {
+		t.Errorf("createAddress(%s, 0x7f) = createAddress(%[1]s, 0x80) = %s", sender, a)
+	}
+}
+
+func TestEvmCreateNonces(t *testing.T) {
+	sender, creator := HexToAddress("0xaa"), HexToAddress("0xcc")
+	state := mustState(t, Accounts{
+		// The account at the creator's third address already has a nonce.
+		createAddress(creator, 2).Hex(): {Nonce: "0x1"},
+	})
+	tx := Transaction{From: sender.Hex(), To: creator.Hex()}
+
+	// CREATE twice with empty init code.
+	create, _ := hex.DecodeString("600060006000f0600060006000f0")
+	res := Evm(create, tx, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(CREATE, CREATE).Err = %v", res.Err)
+	}
+	for i, want := range []Address{createAddress(creator, 1), createAddress(creator, 0)} {
+		if got := wordToAddress(&res.Stack[i]); got != want {
+			t.Errorf("address of CREATE %d = %s; want %s", 2-i, got, want)
+		}
+		if got := state.GetNonce(want); got != 1 {
+			t.Errorf("nonce of created %s = %d; want 1", want, got)
+		}
+	}
+	if got := state.GetNonce(creator); got != 2 {
+		t.Errorf("creator nonce = %d; want 2", got)
+	}
+	if got := state.GetNonce(sender); got != 1 {
+		t.Errorf("sender nonce = %d; want 1", got)
+	}
+
+	// The third CREATE collides, but still uses up the creator's nonce.
+	res = Evm(create[:7], tx, BlockContext{}, state)
+	if res.Failed() || !res.Stack[0].IsZero() {
+		t.Fatalf("Evm(CREATE) = %v, %v; want [0x0], nil", res.Stack, res.Err)
+	}
+	if got := state.GetNonce(creator); got != 3 {
+		t.Errorf("creator nonce after collision = %d; want 3", got)
+	}
+
+	// A failed transaction still uses up the sender's nonce.
+	if res = Evm([]byte{0xfe}, tx, BlockContext{}, state); !res.Failed() {
+		t.Fatalf("Evm(INVALID) succeeded")
+	}
+	if got := state.GetNonce(sender); got != 3 {
+		t.Errorf("sender nonce after failed transaction = %d; want 3", got)
+	}
+}
+
+func TestCreate2Address(t *testing.T) {
+	// Examples from EIP-1014.
+	tests := []struct {
+		sender, salt, initCode, want string
+	}{
+		{"0x0", "0x0", "00", "0x4d1a2e2bb4f88f0250f26ffff098b0b30b26bf38"},
+		{"0xdeadbeef00000000000000000000000000000000", "0x0", "00", "0xb928f69bb1d91cd65274e3c79d8986362984fda3"},
+		{"0xdeadbeef", "0xcafebabe", "deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef", "0x1d8bfdc5d46dc4f61d6b6115972536ebe6a8854c"},
+		{"0x0", "0x0", "", "0xe33c0c7f7df4809055c3eba6c09cfe4baf1bd9e0"},
+	}
+	for _, tt := range tests {
+		initCode, _ := hex.DecodeString(tt.initCode)
+		if got := create2Address(HexToAddress(tt.sender), hexToWord(tt.salt), initCode); got.Hex() != tt.want {
+			t.Errorf("create2Address(%s, %s, %s) = %s; want %s", tt.sender, tt.salt, tt.initCode, got, tt.want)
+		}
+	}
+}
+
+func TestEvmCreate2(t *testing.T) {
+	creator := HexToAddress("0xcc")
+	state := mustState(t, nil)
+
+	// CREATE2 with salt 1 and empty init code.
+	create2, _ := hex.DecodeString("6001600060006000f5")
+	res := Evm(create2, Transaction{To: creator.Hex()}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(CREATE2).Err = %v", res.Err)
+	}
+	want := create2Address(creator, NewWord(1), nil)
+	if got := wordToAddress(&res.Stack[0]); got != want {
+		t.Errorf("address of CREATE2 = %s; want %s", got, want)
+	}
+	if !state.Exist(want) {
+		t.Errorf("no account at %s after CREATE2", want)
+	}
+
+	// The same salt and init code always give the same address, so deploying
+	// again collides.
+	res = Evm(create2, Transaction{To: creator.Hex()}, BlockContext{}, state)
+	if res.Failed() || !res.Stack[0].IsZero() {
+		t.Errorf("Evm(CREATE2) again = %v, %v; want [0x0], nil", res.Stack, res.Err)
+	}
+}
+
+func TestEvmValueTransfer(t *testing.T) {
+	sender, contract, callee := HexToAddress("0xaa"), HexToAddress("0xcc"), HexToAddress("0xbb")
+	state := mustState(t, Accounts{
+		sender.Hex(): {Balance: "0x10"},
+		// REVERT
+		"0xdd": {UserCode: usercode{Bin: "60006000fd"}},
+	})
+	balances := func(want ...string) {
+		t.Helper()
+		for i, addr := range []Address{sender, contract, callee} {
+			if got := state.GetBalance(addr); got.Hex() != want[i] {
+				t.Errorf("balance of %s = %s; want %s", addr, got.Hex(), want[i])
+			}
+		}
+	}
+
+	// The transaction sends 4 wei to the contract, which passes 3 on to the
+	// callee.
+	call, _ := hex.DecodeString("6000600060006000600360bb5af1")
+	res := Evm(call, Transaction{From: sender.Hex(), To: contract.Hex(), Value: "0x4"}, BlockContext{}, state)
+	if res.Failed() || res.Stack[0].Uint64() != 1 {
+		t.Fatalf("Evm(CALL) = %v, %v; want [0x1], nil", res.Stack, res.Err)
+	}
+	balances("0xc", "0x1", "0x3")
+
+	// A call the contract cannot afford fails without moving anything, and so
+	// does one whose callee reverts.
+	for _, bin := range []string{"6000600060006000600260bb5af1", "6000600060006000600160dd5af1"} {
+		call, _ := hex.DecodeString(bin)
+		res = Evm(call, Transaction{To: contract.Hex()}, BlockContext{}, state)
+		if res.Failed() || !res.Stack[0].IsZero() {
+			t.Fatalf("Evm(%s) = %v, %v; want [0x0], nil", bin, res.Stack, res.Err)
+		}
+		balances("0xc", "0x1", "0x3")
+	}
+
+	// CREATE debits the creator.
+	create, _ := hex.DecodeString("600060006001f0")
+	res = Evm(create, Transaction{To: contract.Hex()}, BlockContext{}, state)
+	if res.Failed() || res.Stack[0].IsZero() {
+		t.Fatalf("Evm(CREATE) = %v, %v", res.Stack, res.Err)
+	}
+	balances("0xc", "0x0", "0x3")
+	if got := state.GetBalance(wordToAddress(&res.Stack[0])); got.Uint64() != 1 {
+		t.Errorf("balance of created contract = %s; want 0x1", got.Hex())
+	}
+
+	// A transaction the sender cannot afford does not run, and keeps its nonce.
+	res = Evm([]byte{0x00}, Transaction{From: sender.Hex(), To: contract.Hex(), Value: "0x100"}, BlockContext{}, state)
+	if !errors.Is(res.Err, ErrInsufficientBalance) {
+		t.Fatalf("Evm(STOP).Err = %v; want %v", res.Err, ErrInsufficientBalance)
+	}
+	if got := state.GetNonce(sender); got != 1 {
+		t.Errorf("sender nonce = %d; want 1", got)
+	}
+	balances("0xc", "0x0", "0x3")
+}
+
+func TestEvmCallFrames(t *testing.T) {
+	sender, contract := HexToAddress("0xaa"), HexToAddress("0xcc")
+	state := mustState(t, Accounts{
+		sender.Hex(): {Balance: "0xa"},
+		// Return the calldata.
+		"0xbb": {UserCode: usercode{Bin: "366000600037366000f3"}},
+		// SSTORE(0, CALLER), SSTORE(1, CALLVALUE), SSTORE(2, NUMBER)
+		"0xdd": {UserCode: usercode{Bin: "336000553460015543600255"}},
+	})
+	tx := Transaction{From: sender.Hex(), To: contract.Hex(), Value: "0x5"}
+
+	// The callee sees the 32 bytes of memory passed as its calldata.
+	call, _ := hex.DecodeString("602a6000526020602060206000600060bb5af1602051")
+	res := Evm(call, tx, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(CALL).Err = %v", res.Err)
+	}
+	if got := bigInts(res.Stack); len(got) != 2 || got[0].Uint64() != 0x2a || got[1].Uint64() != 1 {
+		t.Errorf("Evm(CALL) stack = %v; want [0x2a 0x1]", toHexStrings(got))
+	}
+
+	// Under DELEGATECALL the callee's code runs with the caller, value and
+	// storage of the calling frame, in the same block.
+	delegate, _ := hex.DecodeString("600060006000600060dd5af4")
+	res = Evm(delegate, tx, BlockContext{Number: "0x10"}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(DELEGATECALL).Err = %v", res.Err)
+	}
+	for slot, want := range []*Word{sender.Word(), NewWord(5), NewWord(0x10)} {
+		if got := state.GetState(contract, *NewWord(uint64(slot))); !got.Eq(want) {
+			t.Errorf("storage slot %d = %s; want %s", slot, got.Hex(), want.Hex())
+		}
+	}
+}
+
+func TestEvmStaticCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		callee  string
+		success bool
+		want    uint64 // first word returned by the callee
+	}{
+		{"SSTORE", "6001600055", false, 0},
+		{"LOG0", "60006000a0", false, 0},
+		{"CREATE", "600060006000f0", false, 0},
+		{"SELFDESTRUCT", "60aaff", false, 0},
+		{"TSTORE", "600160005d", false, 0},
+		{"TLOAD", "60005c" + "60005260206000f3", true, 0},
+		{"CALL with value", "6000600060006000600160aa5af1", false, 0},
+		{"CALL without value", "6000600060006000600060aa5af1" + "60005260206000f3", true, 1},
+		// The nested call inherits the write protection, so its SSTORE fails.
+		{"nested SSTORE", "6000600060006000600060ee5af1" + "60005260206000f3", true, 0},
+		// BALANCE + SLOAD(0) + EXTCODESIZE see the callee's real state.
+		{"reads", "60bb31600054" + "60bb3b0101" + "60005260206000f3", true, 1 + 2 + 19},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := mustState(t, Accounts{
+				"0xbb": {Balance: "0x1", UserCode: usercode{Bin: tt.callee}, Storage: Store{*NewWord(0): *NewWord(2)}},
+				"0xee": {UserCode: usercode{Bin: "6001600055"}},
+			})
+			// STATICCALL 0xbb, returning 32 bytes, then MLOAD them.
+			bin, _ := hex.DecodeString("6020600060006000" + "60bb5afa600051")
+			res := Evm(bin, Transaction{To: "0xcc"}, BlockContext{}, state)
+			if res.Failed() {
+				t.Fatalf("Evm(STATICCALL).Err = %v", res.Err)
+			}
+			if got := res.Stack[1].Uint64() == 1; got != tt.success {
+				t.Errorf("STATICCALL success = %t; want %t", got, tt.success)
+			}
+			if got := res.Stack[0].Uint64(); got != tt.want {
+				t.Errorf("STATICCALL returned %d; want %d", got, tt.want)
+			}
+			if got := state.GetState(HexToAddress("0xee"), *NewWord(0)); !got.IsZero() {
+				t.Errorf("storage of 0xee slot 0 = %s; want 0x0", got.Hex())
+			}
+		})
+	}
+}
+
+func TestEvmTransientStorage(t *testing.T) {
+	state := mustState(t, Accounts{
+		// RETURN(TLOAD(1))
+		"0xbb": {UserCode: usercode{Bin: "60015c" + "60005260206000f3"}},
+		// TSTORE(1, 5), then REVERT.
+		"0xdd": {UserCode: usercode{Bin: "600560015d" + "60006000fd"}},
+	})
+	bin, _ := hex.DecodeString("602a60015d" + // TSTORE(1, 0x2a)
+		"6020600060006000" + "60bb5af4" + "600051" + // DELEGATECALL 0xbb, MLOAD(0)
+		"6020600060006000600060bb5af1" + "600051" + // CALL 0xbb, MLOAD(0)
+		"6000600060006000" + "60dd5af4" + // DELEGATECALL 0xdd
+		"60015c") // TLOAD(1)
+	res := Evm(bin, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(TSTORE).Err = %v", res.Err)
+	}
+	// The DELEGATECALL sees the caller's transient storage and the CALL does
+	// not; the reverted TSTORE is undone.
+	want := []string{"0x2a", "0x0", "0x0", "0x1", "0x2a", "0x1"}
+	if got := toHexStrings(bigInts(res.Stack)); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("stack = %v; want %v", got, want)
+	}
+
+	// Transient storage does not outlive the transaction.
+	tload, _ := hex.DecodeString("60015c")
+	if res := Evm(tload, Transaction{To: "0xcc"}, BlockContext{}, state); res.Failed() || !res.Stack[0].IsZero() {
+		t.Errorf("TLOAD in the next transaction = %v, %v; want [0x0], nil", res.Stack, res.Err)
+	}
+}
+
+func TestEvmMcopy(t *testing.T) {
+	// MSTORE(0, 0x000102…1f)
+	setup := "7f" + "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" + "600052"
+	tests := []struct {
+		name       string
+		dst, src   string
+		size       string
+		want       string // MLOAD(0) afterwards
+		wantMemory uint64
+	}{
+		{"forward overlap", "01", "00", "08", "0x00000102030405060709" + "0a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", 32},
+		{"backward overlap", "00", "01", "08", "0x01020304050607080809" + "0a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", 32},
+		{"same place", "00", "00", "20", "0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", 32},
+		// Copying the word up expands memory to cover the destination.
+		{"expand", "20", "00", "20", "0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", 64},
+		// And reading beyond it reads zeros, expanding to cover the source.
+		{"read beyond", "00", "30", "20", "0x0000000000000000000000000000000000000000000000000000000000000000", 96},
+		{"nothing", "ff", "ff", "00", "0x000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, _ := hex.DecodeString(setup + "60" + tt.size + "60" + tt.src + "60" + tt.dst + "5e" + "59600051")
+			res := Evm(bin, Transaction{}, BlockContext{}, nil)
+			if res.Failed() {
+				t.Fatalf("Evm(MCOPY).Err = %v", res.Err)
+			}
+			if got := res.Stack[0]; !got.Eq(hexToWord(tt.want)) {
+				t.Errorf("memory = %s; want %s", got.Hex(), tt.want)
+			}
+			if got := res.Stack[1].Uint64(); got != tt.wantMemory {
+				t.Errorf("MSIZE = %d; want %d", got, tt.wantMemory)
+			}
+		})
+	}
+}
+
+func TestEvmBlockHash(t *testing.T) {
+	var asked []uint64
+	Block := BlockContext{Number: "0x200", GetHash: func(number uint64) Word {
+		asked = append(asked, number)
+		return keccak256Word(NewWord(number).Bytes())
+	}}
+	tests := []struct {
+		name   string
+		number string
+		hashed bool
+	}{
+		{"previous block", "0x1ff", true},
+		{"oldest in range", "0x100", true},
+		{"too old", "0xff", false},
+		{"current block", "0x200", false},
+		{"future block", "0x201", false},
+		{"huge", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked = nil
+			number := hexToWord(tt.number)
+			push := number.Bytes32()
+			bin, _ := hex.DecodeString("7f" + hex.EncodeToString(push[:]) + "40")
+			res := Evm(bin, Transaction{}, Block, nil)
+			if res.Failed() {
+				t.Fatalf("Evm(BLOCKHASH).Err = %v", res.Err)
+			}
+			want := new(Word)
+			if tt.hashed {
+				*want = keccak256Word(number.Bytes())
+			}
+			if got := res.Stack[0]; !got.Eq(want) {
+				t.Errorf("BLOCKHASH(%s) = %s; want %s", tt.number, got.Hex(), want.Hex())
+			}
+			// Blocks out of range are never looked up.
+			if got := len(asked) == 1; got != tt.hashed {
+				t.Errorf("GetHash called for %v", asked)
+			}
+		})
+	}
+
+	// Without a history every hash is zero.
+	bin, _ := hex.DecodeString("6101ff40")
+	if res := Evm(bin, Transaction{}, BlockContext{Number: "0x200"}, nil); res.Failed() || !res.Stack[0].IsZero() {
+		t.Errorf("BLOCKHASH without GetHash = %v, %v; want [0x0], nil", res.Stack, res.Err)
+	}
+}
+
+func TestEvmCallCode(t *testing.T) {
+	contract, library := HexToAddress("0xcc"), HexToAddress("0xdd")
+	state := mustState(t, Accounts{
+		contract.Hex(): {Balance: "0x5"},
+		// SSTORE(0, CALLER), SSTORE(1, CALLVALUE), SSTORE(2, ADDRESS)
+		library.Hex(): {UserCode: usercode{Bin: "336000553460015530600255"}},
+	})
+
+	// CALLCODE the library with 3 wei.
+	bin, _ := hex.DecodeString("6000600060006000600360dd5af2")
+	res := Evm(bin, Transaction{To: contract.Hex()}, BlockContext{}, state)
+	if res.Failed() || res.Stack[0].Uint64() != 1 {
+		t.Fatalf("Evm(CALLCODE) = %v, %v; want [0x1], nil", res.Stack, res.Err)
+	}
+	// The library's code ran against the contract's storage, called by the
+	// contract itself.
+	for slot, want := range []*Word{contract.Word(), NewWord(3), contract.Word()} {
+		if got := state.GetState(contract, *NewWord(uint64(slot))); !got.Eq(want) {
+			t.Errorf("storage slot %d = %s; want %s", slot, got.Hex(), want.Hex())
+		}
+	}
+	if got := state.GetState(library, *NewWord(0)); !got.IsZero() {
+		t.Errorf("library storage slot 0 = %s; want 0x0", got.Hex())
+	}
+	// The value was sent to the contract itself.
+	if got := state.GetBalance(contract); got.Uint64() != 5 {
+		t.Errorf("contract balance = %s; want 0x5", got.Hex())
+	}
+	if got := state.GetBalance(library); !got.IsZero() {
+		t.Errorf("library balance = %s; want 0x0", got.Hex())
+	}
+}
+
+func TestEvmReturnData(t *testing.T) {
+	callBB := "6000600060006000600060bb5af150" // CALL 0xbb, POP
+	tests := []struct {
+		name    string
+		bin     string
+		want    string // top of the stack
+		wantErr error
+	}{
+		{"RETURNDATASIZE after CALL", callBB + "3d", "0x1", nil},
+		{"RETURNDATACOPY within bounds", callBB + "600160006000" + "3e600051", "0x2a" + strings.Repeat("0", 62), nil},
+		{"RETURNDATACOPY past the end", callBB + "600260006000" + "3e", "", ErrReturnDataOutOfBounds},
+		{"RETURNDATACOPY huge offset", callBB + "6001" + "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff" + "60003e", "", ErrReturnDataOutOfBounds},
+		// A successful CREATE leaves no return data.
+		{"RETURNDATASIZE after CREATE", callBB + "600060006000f050" + "3d", "0x0", nil},
+		// The init code reverts with 4 bytes.
+		{"RETURNDATASIZE after reverted CREATE", "6c63ffffffff6000526004601cfd600052600d60136000f050" + "3d", "0x4", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := mustState(t, Accounts{
+				// RETURN the byte 0x2a.
+				"0xbb": {UserCode: usercode{Bin: "602a60005360016000f3"}},
+			})
+			bin, err := hex.DecodeString(tt.bin)
+			if err != nil {
+				t.Fatalf("hex.DecodeString(%q) error %v", tt.bin, err)
+			}
+			res := Evm(bin, Transaction{To: "0xcc"}, BlockContext{}, state)
+			if !errors.Is(res.Err, tt.wantErr) {
+				t.Fatalf("Evm(%s).Err = %v; want %v", tt.bin, res.Err, tt.wantErr)
+			}
+			if tt.wantErr == nil && res.Stack[0].Hex() != tt.want {
+				t.Errorf("Evm(%s) top of stack = %s; want %s", tt.bin, res.Stack[0].Hex(), tt.want)
+			}
+		})
+	}
+}
+
+func TestEvmReturnHalts(t *testing.T) {
+	// MSTORE8(0, 0x2a), RETURN(0, 1), SSTORE(0, 1)
+	bin, _ := hex.DecodeString("602a600053" + "60016000f3" + "6001600055")
+	state := mustState(t, nil)
+	res := Evm(bin, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(RETURN).Err = %v", res.Err)
+	}
+	if got := hex.EncodeToString(res.ReturnData); got != "2a" {
+		t.Errorf("Evm(RETURN).ReturnData = %s; want 2a", got)
+	}
+	if got := state.GetState(HexToAddress("0xcc"), *NewWord(0)); !got.IsZero() {
+		t.Errorf("storage slot 0 = %s; want 0x0, the SSTORE after RETURN ran", got.Hex())
+	}
+}
+
+func TestEvmSelfDestruct(t *testing.T) {
+	contract, beneficiary := HexToAddress("0xcc"), HexToAddress("0xa1")
+	victim, selfish := HexToAddress("0xdead"), HexToAddress("0x5e1f")
+	// CALL 0xdead, CALL 0x5e1f, then CREATE with 5 wei a contract whose init
+	// code is SELFDESTRUCT(0xa1).
+	bin, _ := hex.DecodeString("6000600060006000600061dead5af150" + "6000600060006000600061" + "5e1f5af150" + "6260a1ff600052" + "6003601d6005f0")
+	created := createAddress(contract, 0)
+
+	for _, tt := range []struct {
+		fork                    Fork
+		victimGone, selfishGone bool
+	}{
+		{London, true, true},
+		{Cancun, false, false},
+	} {
+		t.Run(tt.fork.String(), func(t *testing.T) {
+			state := mustState(t, Accounts{
+				contract.Hex(): {Balance: "0x5"},
+				// SELFDESTRUCT(0xa1)
+				victim.Hex(): {Balance: "0x7", UserCode: usercode{Bin: "60a1ff"}},
+				// SELFDESTRUCT(ADDRESS)
+				selfish.Hex(): {Balance: "0x3", UserCode: usercode{Bin: "30ff"}},
+			})
+			in := &Interpreter{Fork: tt.fork}
+			res := in.Run(bin, Transaction{To: contract.Hex()}, BlockContext{}, state)
+			if res.Failed() {
+				t.Fatalf("Run(…).Err = %v", res.Err)
+			}
+			if got := wordToAddress(&res.Stack[0]); got != created {
+				t.Fatalf("CREATE = %s; want %s", got, created)
+			}
+
+			// The balances of the victim and the created contract go to the
+			// beneficiary whether or not they are deleted.
+			if got := state.GetBalance(beneficiary); got.Uint64() != 7+5 {
+				t.Errorf("beneficiary balance = %s; want 0xc", got.Hex())
+			}
+			if got := state.Exist(victim); got == tt.victimGone {
+				t.Errorf("victim exists = %t; want %t", got, !tt.victimGone)
+			}
+			if got := state.GetBalance(victim); !got.IsZero() {
+				t.Errorf("victim balance = %s; want 0x0", got.Hex())
+			}
+			// A contract created in the same transaction is always deleted.
+			if state.Exist(created) {
+				t.Errorf("created contract %s still exists", created)
+			}
+			// A contract that is its own beneficiary loses its balance only
+			// if it is deleted.
+			if got := state.Exist(selfish); got == tt.selfishGone {
+				t.Errorf("selfish exists = %t; want %t", got, !tt.selfishGone)
+			} else if got := state.GetBalance(selfish); !tt.selfishGone && got.Uint64() != 3 {
+				t.Errorf("selfish balance = %s; want 0x3", got.Hex())
+			}
+		})
+	}
+}
+
+func TestEvmSelfDestructHalts(t *testing.T) {
+	// SELFDESTRUCT(0xa1), SSTORE(0, 1)
+	state := mustState(t, nil)
+	res := Evm([]byte{0x60, 0xa1, 0xff, 0x60, 0x01, 0x60, 0x00, 0x55}, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(SELFDESTRUCT).Err = %v", res.Err)
+	}
+	if got := state.GetState(HexToAddress("0xcc"), *NewWord(0)); !got.IsZero() {
+		t.Errorf("storage slot 0 = %s; want 0x0, the SSTORE after SELFDESTRUCT ran", got.Hex())
+	}
+}
+
 // fatalAndBugReport calls t.Errorf(format, a...) and then t.Fatal() with a
 // message requesting that the student files a bug report. It's intended use is
 // as a replacement for t.Fatal() when the error is in the test setup, not in
@@ -0,0 +1,89 @@
+package evm
+
+// Fork identifies a hard fork of the Ethereum protocol. Forks are ordered:
+// each one includes the changes made by the ones before it. Berlin is the
+// earliest fork supported.
+type Fork int
+
+const (
+	Berlin Fork = iota + 1
+	London
+	Paris // the Merge
+	Shanghai
+	Cancun
+)
+
+// LatestFork is the fork an Interpreter follows unless told otherwise.
+const LatestFork = Cancun
+
+var forkNames = map[Fork]string{
+	Berlin:   "Berlin",
+	London:   "London",
+	Paris:    "Paris",
+	Shanghai: "Shanghai",
+	Cancun:   "Cancun",
+}
+
+// String implements fmt.Stringer.
+func (f Fork) String() string {
+	if name, ok := forkNames[f]; ok {
+		return name
+	}
+	return "unknown fork"
+}
+
+// MaxRefundQuotient returns the divisor of the refund cap under f: a
+// transaction is refunded at most its gas used divided by it.
+func (f Fork) MaxRefundQuotient() uint64 {
+	if f < London {
+		return maxRefundQuotientBerlin
+	}
+	return maxRefundQuotient
+}
+
+// ChainConfig says when each fork activates on a chain: the forks up to Paris
+// at a block number, later ones at a block timestamp. A nil field means the
+// fork never activates, and nor do the ones after it: a fork only activates
+// once every fork before it has. Blocks before LondonBlock follow Berlin, as
+// no earlier fork is supported.
+type ChainConfig struct {
+	LondonBlock  *uint64
+	ParisBlock   *uint64 // first block after the Merge
+	ShanghaiTime *uint64
+	CancunTime   *uint64
+}
+
+// MainnetChainConfig is the ChainConfig of Ethereum mainnet.
+var MainnetChainConfig = &ChainConfig{
+	LondonBlock:  newUint64(12_965_000),
+	ParisBlock:   newUint64(15_537_394),
+	ShanghaiTime: newUint64(1_681_338_455),
+	CancunTime:   newUint64(1_710_338_135),
+}
+
+// Fork returns the fork in force for the block with the given number and
+// timestamp: the last of the forks, in order, that have all activated.
+func (c *ChainConfig) Fork(number, time uint64) Fork {
+	forks := []struct {
+		fork Fork
+		at   *uint64
+		now  uint64
+	}{
+		{London, c.LondonBlock, number},
+		{Paris, c.ParisBlock, number},
+		{Shanghai, c.ShanghaiTime, time},
+		{Cancun, c.CancunTime, time},
+	}
+	fork := Berlin
+	for _, f := range forks {
+		if f.at == nil || *f.at > f.now {
+			break
+		}
+		fork = f.fork
+	}
+	return fork
+}
+
+func newUint64(n uint64) *uint64 {
+	return &n
+}
@@ -0,0 +1,42 @@
+package evm
+
+import "testing"
+
+func TestChainConfigFork(t *testing.T) {
+	tests := []struct {
+		number, time uint64
+		want         Fork
+	}{
+		{0, 0, Berlin},
+		{12_244_000, 1_618_000_000, Berlin},
+		{12_965_000, 1_628_000_000, London},
+		{15_537_393, 1_663_224_162, London},
+		{15_537_394, 1_663_224_179, Paris},
+		{17_034_869, 1_681_338_443, Paris},
+		{17_034_870, 1_681_338_455, Shanghai},
+		{19_426_587, 1_710_338_135, Cancun},
+	}
+	for _, tt := range tests {
+		if got := MainnetChainConfig.Fork(tt.number, tt.time); got != tt.want {
+			t.Errorf("MainnetChainConfig.Fork(%d, %d) = %s; want %s", tt.number, tt.time, got, tt.want)
+		}
+	}
+
+	// Forks left unset never activate, and nor do the forks after them.
+	config := &ChainConfig{LondonBlock: newUint64(5), CancunTime: newUint64(10)}
+	if got := config.Fork(100, 9); got != London {
+		t.Errorf("Fork(100, 9) = %s; want London", got)
+	}
+	if got := config.Fork(100, 10); got != London {
+		t.Errorf("Fork(100, 10) = %s; want London", got)
+	}
+
+	// A fork only activates after the ones before it, whatever its own time.
+	config = &ChainConfig{LondonBlock: newUint64(5), ParisBlock: newUint64(5), ShanghaiTime: newUint64(0), CancunTime: newUint64(0)}
+	if got := config.Fork(0, 10); got != Berlin {
+		t.Errorf("Fork(0, 10) = %s; want Berlin", got)
+	}
+	if got := config.Fork(5, 10); got != Cancun {
+		t.Errorf("Fork(5, 10) = %s; want Cancun", got)
+	}
+}
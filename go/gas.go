@@ -0,0 +1,310 @@
+package evm
+
+import "math"
+
+// Gas schedule, as of the Cancun hard fork. Costs that depend on operands or
+// state are charged by the interpreter on top of the constant cost in the jump
+// table. The costs that changed since Berlin are picked per fork by
+// newGasSchedule.
+const (
+	gasZero        uint64 = 0
+	gasJumpdest    uint64 = 1
+	gasQuickStep   uint64 = 2
+	gasFastestStep uint64 = 3
+	gasFastStep    uint64 = 5
+	gasMidStep     uint64 = 8
+	gasSlowStep    uint64 = 10
+	gasExtStep     uint64 = 20
+
+	gasExpByte   uint64 = 50    // per byte of the EXP exponent
+	gasSha3      uint64 = 30    // SHA3 base cost
+	gasSha3Word  uint64 = 6     // per word hashed by SHA3
+	gasCopy      uint64 = 3     // per word copied by the *COPY opcodes
+	gasLog       uint64 = 375   // LOG base cost
+	gasLogTopic  uint64 = 375   // per LOG topic
+	gasLogData   uint64 = 8     // per byte of LOG data
+	gasMemory    uint64 = 3     // linear memory cost per word
+	gasQuadDiv   uint64 = 512   // divisor of the quadratic memory cost
+	gasCreate    uint64 = 32000 // CREATE base cost
+	gasInitCode  uint64 = 2     // per word of CREATE init code (EIP-3860)
+	gasCodeByte  uint64 = 200   // per byte of deployed code
+	gasSelfdest  uint64 = 5000  // SELFDESTRUCT base cost
+	gasNewAcct   uint64 = 25000 // CALL or SELFDESTRUCT sending value to an empty account
+	gasCallValue uint64 = 9000  // CALL transferring a non-zero value
+	gasStipend   uint64 = 2300  // free gas given to the callee of a value transfer
+
+	gasWarmAccess        uint64 = 100  // access to an address or slot already used in the transaction
+	gasColdAccountAccess uint64 = 2600 // first access to an address (EIP-2929)
+	gasColdSload         uint64 = 2100 // first access to a storage slot (EIP-2929)
+
+	gasEcrecover     uint64 = 3000  // ECRECOVER precompile
+	gasSha256Base    uint64 = 60    // SHA256 precompile base cost
+	gasSha256Word    uint64 = 12    // per word hashed by the SHA256 precompile
+	gasRipemd160Base uint64 = 600   // RIPEMD160 precompile base cost
+	gasRipemd160Word uint64 = 120   // per word hashed by the RIPEMD160 precompile
+	gasIdentityBase  uint64 = 15    // IDENTITY precompile base cost
+	gasIdentityWord  uint64 = 3     // per word copied by the IDENTITY precompile
+	gasModExpMin     uint64 = 200   // minimum cost of the MODEXP precompile (EIP-2565)
+	gasEcAdd         uint64 = 150   // ECADD precompile (EIP-1108)
+	gasEcMul         uint64 = 6000  // ECMUL precompile (EIP-1108)
+	gasEcPairingBase uint64 = 45000 // ECPAIRING precompile base cost (EIP-1108)
+	gasEcPairingPair uint64 = 34000 // per pair checked by the ECPAIRING precompile
+	gasBlake2fRound  uint64 = 1     // per round of the BLAKE2F precompile (EIP-152)
+	gasPointEval     uint64 = 50000 // point evaluation precompile (EIP-4844)
+
+	gasSstoreSet      uint64 = 20000 // SSTORE turning a zero slot non-zero
+	gasSstoreReset    uint64 = 2900  // SSTORE changing a non-zero slot, excluding the cold surcharge
+	gasSstoreSentry   uint64 = 2300  // SSTORE fails unless more than this is left (EIP-2200)
+	gasSstoreRefund   uint64 = 4800  // refund for clearing a slot (EIP-3529)
+	maxRefundQuotient uint64 = 5     // refunds are capped at gas used / 5 (EIP-3529)
+
+	defaultGasLimit uint64 = 30_000_000 // gas limit of a transaction whose block sets none either
+
+	// Before London (EIP-3529).
+	gasSstoreRefundBerlin   uint64 = 15000 // refund for clearing a slot
+	gasSelfdestRefundBerlin uint64 = 24000 // refund for a contract's first SELFDESTRUCT
+	maxRefundQuotientBerlin uint64 = 2     // refunds are capped at gas used / 2
+)
+
+// gasSchedule holds the costs and refund rules that depend on the fork. The
+// refund cap, which the caller applies, is given by Fork.MaxRefundQuotient.
+type gasSchedule struct {
+	initCodeWord   uint64 // per word of CREATE init code; none before Shanghai
+	sstoreRefund   uint64 // refund for clearing a slot
+	selfdestRefund uint64 // refund for a contract's first SELFDESTRUCT; none since London
+	warmCoinbase   bool   // the coinbase starts out warm, since Shanghai (EIP-3651)
+}
+
+// newGasSchedule returns the gas schedule of fork.
+func newGasSchedule(fork Fork) *gasSchedule {
+	g := &gasSchedule{
+		initCodeWord: gasInitCode,
+		sstoreRefund: gasSstoreRefund,
+		warmCoinbase: true,
+	}
+	if fork < Shanghai {
+		g.initCodeWord = 0
+		g.warmCoinbase = false
+	}
+	if fork < London {
+		g.sstoreRefund = gasSstoreRefundBerlin
+		g.selfdestRefund = gasSelfdestRefundBerlin
+	}
+	return g
+}
+
+// gasMeter tracks the gas of a single call frame.
+type gasMeter struct {
+	limit uint64
+	used  uint64
+}
+
+// consume charges amount, or reports ErrOutOfGas and uses up the whole limit if
+// less than amount is left.
+func (g *gasMeter) consume(amount uint64) error {
+	if amount > g.limit-g.used {
+		g.used = g.limit
+		return ErrOutOfGas
+	}
+	g.used += amount
+	return nil
+}
+
+// remaining returns the gas left in the frame.
+func (g *gasMeter) remaining() uint64 {
+	return g.limit - g.used
+}
+
+// forward reserves gas for a sub-call that asked for requested gas and returns
+// the meter the callee runs with. At most all but one 64th of the remaining gas
+// is passed on (EIP-150).
+func (g *gasMeter) forward(requested uint64) gasMeter {
+	available := g.remaining()
+	available -= available / 64
+	if requested > available {
+		requested = available
+	}
+	g.used += requested
+	return gasMeter{limit: requested}
+}
+
+// settle accounts for a finished sub-call: the callee's unused gas is returned.
+func (g *gasMeter) settle(callee gasMeter) {
+	g.used -= callee.limit - callee.used
+}
+
+// callGasArg returns the gas operand of a CALL-like opcode, saturated to the
+// largest uint64. forward caps it at what is actually available.
+func callGasArg(gas *Word) uint64 {
+	if !gas.IsUint64() {
+		return math.MaxUint64
+	}
+	return gas.Uint64()
+}
+
+// toWordSize returns the number of 32-byte words needed to hold size bytes.
+func toWordSize(size uint64) uint64 {
+	if size > math.MaxUint64-31 {
+		return math.MaxUint64/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// storageKey identifies a storage slot of an account.
+type storageKey struct {
+	address Address
+	slot    Word
+}
+
+// txContext holds the bookkeeping shared by every call frame of a
+// transaction: the addresses and slots already accessed (EIP-2929), the
+// storage values from before the transaction started, the refund counter, the
+// contracts created and self-destructed so far, and transient storage
+// (EIP-1153). Changes to it are journaled, so that a failed call frame can undo
+// them along with its state changes.
+type txContext struct {
+	warmAddresses map[Address]bool
+	warmSlots     map[storageKey]bool
+	original      map[storageKey]Word
+	refund        uint64
+	created       map[Address]bool
+	destructed    map[Address]bool
+	transient     map[storageKey]Word
+	journal       journal
+	gas           *gasSchedule
+}
+
+// newTxContext returns the context for transaction under the gas schedule gas.
+// The sender and the recipient start out warm, and so does the block's
+// coinbase if the schedule says so.
+func newTxContext(transaction Transaction, Block BlockContext, gas *gasSchedule) *txContext {
+	ctx := &txContext{
+		warmAddresses: make(map[Address]bool),
+		warmSlots:     make(map[storageKey]bool),
+		original:      make(map[storageKey]Word),
+		created:       make(map[Address]bool),
+		destructed:    make(map[Address]bool),
+		transient:     make(map[storageKey]Word),
+		gas:           gas,
+	}
+	warm := []string{transaction.From, transaction.Origin, transaction.To}
+	if gas.warmCoinbase {
+		warm = append(warm, Block.Coinbase)
+	}
+	for _, address := range warm {
+		if address != "" {
+			ctx.warmAddresses[HexToAddress(address)] = true
+		}
+	}
+	return ctx
+}
+
+// accessAddress marks address as accessed, and reports whether it already was.
+func (ctx *txContext) accessAddress(address Address) (warm bool) {
+	if ctx.warmAddresses[address] {
+		return true
+	}
+	ctx.warmAddresses[address] = true
+	ctx.journal.append(func() { delete(ctx.warmAddresses, address) })
+	return false
+}
+
+// accessSlot marks a storage slot as accessed, and reports whether it already
+// was.
+func (ctx *txContext) accessSlot(key storageKey) (warm bool) {
+	if ctx.warmSlots[key] {
+		return true
+	}
+	ctx.warmSlots[key] = true
+	ctx.journal.append(func() { delete(ctx.warmSlots, key) })
+	return false
+}
+
+// markCreated records that a contract was created at address.
+func (ctx *txContext) markCreated(address Address) {
+	setJournaled(&ctx.journal, ctx.created, address)
+}
+
+// markDestructed records that the contract at address self-destructed, so that
+// it is deleted at the end of the transaction.
+func (ctx *txContext) markDestructed(address Address) {
+	setJournaled(&ctx.journal, ctx.destructed, address)
+}
+
+// setTransient sets a slot of transient storage, which is discarded at the end
+// of the transaction.
+func (ctx *txContext) setTransient(key storageKey, value Word) {
+	prev := ctx.transient[key]
+	ctx.journal.append(func() { ctx.transient[key] = prev })
+	ctx.transient[key] = value
+}
+
+// setJournaled adds address to set, journaling the change.
+func setJournaled(j *journal, set map[Address]bool, address Address) {
+	if !set[address] {
+		set[address] = true
+		j.append(func() { delete(set, address) })
+	}
+}
+
+// accessGas returns the cost of reading an address or slot: gasWarmAccess if it
+// is warm, cold otherwise.
+func accessGas(warm bool, cold uint64) uint64 {
+	if warm {
+		return gasWarmAccess
+	}
+	return cold
+}
+
+func (ctx *txContext) addRefund(gas uint64) {
+	ctx.setRefund(ctx.refund + gas)
+}
+
+func (ctx *txContext) subRefund(gas uint64) {
+	if gas > ctx.refund {
+		ctx.setRefund(0)
+		return
+	}
+	ctx.setRefund(ctx.refund - gas)
+}
+
+func (ctx *txContext) setRefund(refund uint64) {
+	prev := ctx.refund
+	ctx.journal.append(func() { ctx.refund = prev })
+	ctx.refund = refund
+}
+
+// sstoreGas returns the cost of an SSTORE that changes a slot from current to
+// value, and adjusts the refund counter, following EIP-2200 as amended by
+// EIP-2929 and, since London, EIP-3529. original is the slot's value at the start of the
+// transaction. The cold access surcharge is not included.
+func (ctx *txContext) sstoreGas(original, current, value *Word) uint64 {
+	if current.Eq(value) {
+		return gasWarmAccess
+	}
+	if original.Eq(current) {
+		if original.IsZero() {
+			return gasSstoreSet
+		}
+		if value.IsZero() {
+			ctx.addRefund(ctx.gas.sstoreRefund)
+		}
+		return gasSstoreReset
+	}
+	// The slot was already written in this transaction.
+	if !original.IsZero() {
+		if current.IsZero() {
+			ctx.subRefund(ctx.gas.sstoreRefund)
+		} else if value.IsZero() {
+			ctx.addRefund(ctx.gas.sstoreRefund)
+		}
+	}
+	if original.Eq(value) {
+		if original.IsZero() {
+			ctx.addRefund(gasSstoreSet - gasWarmAccess)
+		} else {
+			ctx.addRefund(gasSstoreReset - gasWarmAccess)
+		}
+	}
+	return gasWarmAccess
+}
@@ -0,0 +1,144 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestEvmGas(t *testing.T) {
+	tests := []struct {
+		name    string
+		bin     string
+		gas     string
+		state   Accounts
+		want    uint64 // gas used
+		wantErr error
+	}{
+		{"ADD", "6001600201", "0x186a0", nil, 3 + 3 + 3, nil},
+		{"EXP (2-byte exponent)", "61010060020a", "0x186a0", nil, 3 + 3 + 10 + 2*50, nil},
+		{"SHA3 (2 words)", "604060002050", "0x186a0", nil, 3 + 3 + 30 + 2*6 + 2*3 + 2, nil},
+		{"MSTORE (1 word)", "6000600052", "0x186a0", nil, 3 + 3 + 3 + 3, nil},
+		{"MSTORE (33 words)", "600061040052", "0x186a0", nil, 3 + 3 + 3 + 33*3 + 33*33/512, nil},
+		{"MSTORE (offset too large)", "60007f" + "ff00000000000000000000000000000000000000000000000000000000000000" + "52", "0x186a0", nil, 100000, ErrMemoryOutOfBounds},
+		{"LOG2 (1 byte)", "6000600060016000a2", "0x186a0", nil, 4*3 + 375 + 2*375 + 8 + 3, nil},
+		{"SLOAD (cold, then warm)", "600054506000545060015450", "0x186a0", nil, 3 + 2100 + 2 + 3 + 100 + 2 + 3 + 2100 + 2, nil},
+		{"SSTORE (set)", "6001600055", "0x186a0", nil, 3 + 3 + 20000 + 2100, nil},
+		// The refund is reported separately.
+		{"SSTORE (set and clear)", "60016000556000600055", "0x186a0", nil, 22212, nil},
+		{"SSTORE (sentry)", "6001600055", "0x902", nil, 2306, ErrOutOfGas},
+		{"GAS", "5a", "0x64", nil, 2, nil},
+		{"out of gas", "600160020160030160040160050160060160070160080160090160", "0x10", nil, 16, ErrOutOfGas},
+		// CREATE2 pays for hashing the init code on top of CREATE's per-word cost.
+		{"CREATE2 (1 word)", "6001602060006000f5", "0x186a0", nil, 4*3 + 32000 + 3 + 2 + 6, nil},
+		// The callee fails, using all of the 1000 gas it was given.
+		{"CALL (failing callee)", "6000600060006000600062c0ffee6103e8f1", "0x186a0", Accounts{"0xc0ffee": {UserCode: usercode{Bin: "fe"}}}, 7*3 + 2600 + 1000, nil},
+		// A call the caller cannot afford still pays for the value transfer, but
+		// not for the gas it offered, and the caller is given the stipend.
+		{"CALL (insufficient balance)", "6000600060006000600162c0ffee6103e8f1", "0x186a0", nil, 7*3 + 2600 + 9000 + 25000 - 2300, nil},
+		{"CALLCODE (insufficient balance)", "6000600060006000600162c0ffee6103e8f2", "0x186a0", nil, 7*3 + 2600 + 9000 - 2300, nil},
+		// CALLCODE sends value to the caller itself, so never creates an account.
+		// The stipend the callee does not use is given to the caller.
+		{"CALLCODE (value)", "6000600060006000600162c0ffee6103e8f2", "0x186a0", Accounts{"0x0": {Balance: "0x1"}}, 7*3 + 2600 + 9000 - 2300, nil},
+		{"BLOCKHASH", "600040", "0x186a0", nil, 3 + 20, nil},
+		{"BLOBHASH, BLOBBASEFEE", "5f494a", "0x186a0", nil, 2 + 3 + 2, nil},
+		{"TSTORE, TLOAD", "602a60015d60015c", "0x186a0", nil, 3 + 3 + 100 + 3 + 100, nil},
+		// MCOPY pays per word copied, and to expand memory over the destination.
+		{"MCOPY (1 word)", "6020600060205e", "0x186a0", nil, 3*3 + 3 + 3 + 2*3, nil},
+		{"default gas limit", "6001600055", "", nil, 3 + 3 + 20000 + 2100, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, err := hex.DecodeString(tt.bin)
+			if err != nil {
+				t.Fatalf("hex.DecodeString(%q) error %v", tt.bin, err)
+			}
+			res := Evm(bin, Transaction{Gas: tt.gas}, BlockContext{}, mustState(t, tt.state))
+			if !errors.Is(res.Err, tt.wantErr) {
+				t.Errorf("Evm(%s).Err = %v; want %v", tt.bin, res.Err, tt.wantErr)
+			}
+			if res.GasUsed != tt.want {
+				t.Errorf("Evm(%s).GasUsed = %d; want %d", tt.bin, res.GasUsed, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvmGasRemaining(t *testing.T) {
+	// PUSH1 1, GAS
+	res := Evm([]byte{0x60, 0x01, 0x5a}, Transaction{Gas: "0x2710"}, BlockContext{}, nil)
+	if res.Failed() {
+		t.Fatalf("Evm(GAS).Err = %v", res.Err)
+	}
+	if got, want := res.Stack[0].Uint64(), uint64(10000-3-2); got != want {
+		t.Errorf("GAS = %d; want %d", got, want)
+	}
+
+	// Without a gas limit, the block's applies, or else 30 million.
+	for Block, limit := range map[string]uint64{"0x2710": 10000, "": 30_000_000} {
+		res := Evm([]byte{0x60, 0x01, 0x5a}, Transaction{}, BlockContext{Gaslimit: Block}, nil)
+		if got, want := res.Stack[0].Uint64(), limit-3-2; got != want {
+			t.Errorf("GAS with block gas limit %q = %d; want %d", Block, got, want)
+		}
+	}
+}
+
+func TestEvmGasForks(t *testing.T) {
+	tests := []struct {
+		name   string
+		fork   Fork
+		bin    string
+		Block  BlockContext
+		want   uint64 // gas used
+		refund uint64
+	}{
+		// Setting and clearing a slot refunds all but the warm access.
+		{"SSTORE (set and clear, Berlin)", Berlin, "60016000556000600055", BlockContext{}, 22212, 20000 - 100},
+		{"SSTORE (set and clear, London)", London, "60016000556000600055", BlockContext{}, 22212, 20000 - 100},
+		// The first SELFDESTRUCT of a contract was refunded until London.
+		{"SELFDESTRUCT (Berlin)", Berlin, "30ff", BlockContext{}, 2 + 5000 + 2600, 24000},
+		{"SELFDESTRUCT (London)", London, "30ff", BlockContext{}, 2 + 5000 + 2600, 0},
+		// The coinbase is only warm from the start since Shanghai.
+		{"BALANCE (coinbase, Paris)", Paris, "413150", BlockContext{Coinbase: "0xc0"}, 2 + 2600 + 2, 0},
+		{"BALANCE (coinbase, Shanghai)", Shanghai, "413150", BlockContext{Coinbase: "0xc0"}, 2 + 100 + 2, 0},
+		// So is init code charged per word.
+		{"CREATE (1 word, Paris)", Paris, "602060006000f0", BlockContext{}, 3*3 + 32000 + 3, 0},
+		{"CREATE (1 word, Shanghai)", Shanghai, "602060006000f0", BlockContext{}, 3*3 + 32000 + 3 + 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, _ := hex.DecodeString(tt.bin)
+			res := (&Interpreter{Fork: tt.fork}).Run(bin, Transaction{Gas: "0x186a0"}, tt.Block, nil)
+			if res.Failed() {
+				t.Fatalf("Run(%s).Err = %v", tt.bin, res.Err)
+			}
+			if res.GasUsed != tt.want {
+				t.Errorf("Run(%s).GasUsed = %d; want %d", tt.bin, res.GasUsed, tt.want)
+			}
+			if res.GasRefund != tt.refund {
+				t.Errorf("Run(%s).GasRefund = %d; want %d", tt.bin, res.GasRefund, tt.refund)
+			}
+		})
+	}
+}
+
+func TestForkMaxRefundQuotient(t *testing.T) {
+	// EIP-3529 cut the cap from half the gas used to a fifth.
+	for fork, want := range map[Fork]uint64{Berlin: 2, London: 5, Cancun: 5} {
+		if got := fork.MaxRefundQuotient(); got != want {
+			t.Errorf("%s.MaxRefundQuotient() = %d; want %d", fork, got, want)
+		}
+	}
+}
+
+func TestSstoreRefundForks(t *testing.T) {
+	one, zero := NewWord(1), new(Word)
+	for fork, want := range map[Fork]uint64{Berlin: 15000, London: 4800, Cancun: 4800} {
+		ctx := newTxContext(Transaction{}, BlockContext{}, newGasSchedule(fork))
+		// Clearing a slot that was set before the transaction.
+		ctx.sstoreGas(one, one, zero)
+		if ctx.refund != want {
+			t.Errorf("%s: refund for clearing a slot = %d; want %d", fork, ctx.refund, want)
+		}
+	}
+}
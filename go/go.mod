@@ -3,3 +3,8 @@ module evm-from-scratch-go
 go 1.18
 
 require github.com/google/go-cmp v0.5.9
+
+require (
+	golang.org/x/crypto v0.14.0
+	golang.org/x/sys v0.13.0 // indirect
+)
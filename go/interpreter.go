@@ -0,0 +1,319 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxCallDepth is the number of call frames that may be nested below the
+// transaction's own frame. A CALL or CREATE beyond it fails without side
+// effects: it pushes 0 and its caller keeps the gas.
+const maxCallDepth = 1024
+
+const (
+	maxCodeSize     = 24576           // largest code a creation may deploy (EIP-170)
+	maxInitCodeSize = 2 * maxCodeSize // largest init code a creation may run, since Shanghai (EIP-3860)
+)
+
+// Tracer observes the call frames of an execution. Depth is 0 for the frame
+// of the transaction itself, and op is the opcode that started the frame, or
+// CALL for the transaction.
+type Tracer interface {
+	CaptureEnter(depth int, op string, from, to Address, input []byte, gas uint64, value Word)
+	CaptureExit(depth int, output []byte, gasUsed uint64, err error)
+}
+
+// Interpreter runs EVM code. Sub-calls do not recurse on the Go stack: the
+// interpreter keeps its own stack of call frames, each with its own stack,
+// memory and program counter.
+type Interpreter struct {
+	Fork   Fork         // rules to follow; zero means LatestFork
+	Config *ChainConfig // if set, picks the fork from the block instead of Fork
+	Tracer Tracer       // optional
+
+	// Precompiles are contracts to run alongside the built-in precompiles,
+	// replacing any at the same address. Like them, they start out warm.
+	Precompiles map[Address]Precompile
+
+	transaction Transaction
+	block       BlockContext
+	state       StateDB
+	txCtx       *txContext
+
+	// Chosen by the fork at the start of Run.
+	rules       Fork
+	table       *jumpTable
+	gas         *gasSchedule
+	precompiles map[Address]Precompile
+}
+
+// Run runs the EVM code and returns the result of the execution.
+//
+// The gas limit is taken from transaction.Gas, or if it is empty from
+// Block.Gaslimit, or failing that is 30 million. GasUsed is the cost of
+// execution alone: it includes neither the intrinsic cost of the transaction
+// nor the refund, which is reported in GasRefund. A client charges the sum of
+// GasUsed and the intrinsic cost, less GasRefund capped at that sum divided by
+// Fork.MaxRefundQuotient.
+//
+// If transaction.From is set, the sender's nonce is incremented and
+// transaction.Value is moved from the sender to transaction.To; the
+// transaction fails with ErrInsufficientBalance, leaving state untouched, if
+// the sender cannot afford it. Otherwise the value is only reported by
+// CALLVALUE. If execution fails, every change it made to state other than the
+// nonce is reverted. Either way, Run ends the transaction with state.Finalise.
+func (in *Interpreter) Run(code []byte, transaction Transaction, Block BlockContext, state StateDB) *ExecutionResult {
+	meter := gasMeter{limit: defaultGasLimit}
+	switch {
+	case transaction.Gas != "":
+		meter.limit = callGasArg(hexToWord(transaction.Gas))
+	case Block.Gaslimit != "":
+		meter.limit = callGasArg(hexToWord(Block.Gaslimit))
+	}
+	if state == nil {
+		state, _ = NewMemStateDB(nil)
+	}
+	in.transaction, in.block, in.state = transaction, Block, state
+	in.rules = in.Fork
+	if in.Config != nil {
+		in.rules = in.Config.Fork(hexToUint64(Block.Number), hexToUint64(Block.Timestamp))
+	} else if in.rules == 0 {
+		in.rules = LatestFork
+	}
+	if jumpTables[in.rules] == nil {
+		return &ExecutionResult{State: state, Err: fmt.Errorf("unsupported fork %d", in.rules)}
+	}
+	in.table, in.gas, in.precompiles = jumpTables[in.rules], newGasSchedule(in.rules), activePrecompiles(in.rules, in.Precompiles)
+	in.txCtx = newTxContext(transaction, Block, in.gas)
+	for addr := range in.precompiles {
+		// Precompiles start out warm (EIP-2929).
+		in.txCtx.warmAddresses[addr] = true
+	}
+
+	input, err := hex.DecodeString(strings.TrimPrefix(transaction.Data, "0x"))
+	if err != nil {
+		return &ExecutionResult{State: state, Err: fmt.Errorf("invalid transaction data: %w", err)}
+	}
+	sender, value := HexToAddress(transaction.From), hexToWord(transaction.Value)
+	if transaction.From != "" {
+		if !canTransfer(state, sender, value) {
+			return &ExecutionResult{State: state, Err: fmt.Errorf("%w: %s has %s, sends %s", ErrInsufficientBalance, sender, state.GetBalance(sender).Hex(), value.Hex())}
+		}
+		// Sending the transaction uses up the sender's nonce, whether or not
+		// execution succeeds.
+		state.SetNonce(sender, state.GetNonce(sender)+1)
+	}
+	frame := in.newFrame(0xF1, callFrame{
+		code:     code,
+		caller:   sender,
+		address:  HexToAddress(transaction.To),
+		codeAddr: HexToAddress(transaction.To),
+		value:    *value,
+		input:    input,
+		gas:      meter,
+	})
+	snapshot := state.Snapshot()
+	if transaction.From != "" {
+		transfer(state, sender, frame.address, value)
+	}
+	res := in.execute(frame)
+	if res.Failed() {
+		state.RevertToSnapshot(snapshot)
+		state.Finalise()
+		return res
+	}
+	// Accounts that self-destructed are only deleted once the transaction is
+	// over.
+	for addr := range in.txCtx.destructed {
+		state.SelfDestruct(addr)
+	}
+	res.Logs = append([]Log(nil), state.Logs()...)
+	res.GasRefund = in.txCtx.refund
+	state.Finalise()
+	return res
+}
+
+// callFrame is a call frame: the message that started it, the gas it was
+// given, and its own stack, memory and program counter.
+type callFrame struct {
+	code     []byte
+	caller   Address // CALLER
+	address  Address // ADDRESS, the account whose balance and storage are used
+	codeAddr Address // account the code was loaded from; differs from address under DELEGATECALL
+	value    Word    // CALLVALUE
+	input    []byte  // calldata
+	gas      gasMeter
+	readOnly bool // set under STATICCALL and inherited; state changes fail with ErrWriteProtection
+
+	in     *Interpreter
+	op     byte // opcode that started the frame
+	depth  int
+	stack  *Stack
+	memory *Memory
+	pc     int
+
+	jumpdests bitvec // JUMPDEST positions in code, analyzed at the first jump
+
+	returnData []byte // output of the last sub-call
+	ret        []byte // output of this frame
+
+	// Set by the parent when it starts the frame, for resume.
+	snapshot, ctxSnapshot int    // state to revert to if the frame fails
+	retOffset, retSize    uint64 // where the parent wants the output copied
+}
+
+// fork returns the fork the current run follows.
+func (in *Interpreter) fork() Fork {
+	return in.rules
+}
+
+// newFrame returns a frame for msg, started by op, ready to run.
+func (in *Interpreter) newFrame(op byte, msg callFrame) *callFrame {
+	f := &msg
+	f.in, f.op = in, op
+	f.stack, f.memory = NewStack(), NewMemory()
+	return f
+}
+
+// execute runs frame and every sub-call it makes to completion. Each frame
+// runs until it finishes or starts a sub-call; a sub-call is pushed and run,
+// and when it finishes its caller is resumed with the result.
+func (in *Interpreter) execute(frame *callFrame) *ExecutionResult {
+	frames := []*callFrame{frame}
+	in.captureEnter(frame)
+	for {
+		f := frames[len(frames)-1]
+		child, res := f.run()
+		if child != nil {
+			child.depth = len(frames)
+			in.captureEnter(child)
+			p := in.precompile(child)
+			if p == nil {
+				frames = append(frames, child)
+				continue
+			}
+			f, res = child, child.runPrecompile(p)
+		} else {
+			frames = frames[:len(frames)-1]
+			if f.op == 0xF0 || f.op == 0xF5 {
+				f.depositCode(res)
+			}
+		}
+		in.captureExit(f, res)
+		if len(frames) == 0 {
+			return res
+		}
+		frames[len(frames)-1].resume(f, res)
+	}
+}
+
+// precompile returns the precompiled contract a call frame runs instead of
+// code, or nil if it runs the code.
+func (in *Interpreter) precompile(f *callFrame) Precompile {
+	if f.op == 0xF0 || f.op == 0xF5 {
+		return nil
+	}
+	return in.precompiles[f.codeAddr]
+}
+
+// runPrecompile runs the precompiled contract p in place of f's code.
+func (f *callFrame) runPrecompile(p Precompile) *ExecutionResult {
+	if err := f.gas.consume(p.Gas(f.input)); err != nil {
+		return &ExecutionResult{GasUsed: f.gas.used, State: f.in.state, Err: err}
+	}
+	output, err := p.Run(PrecompileCall{Input: f.input, Caller: f.caller, Value: f.value, ReadOnly: f.readOnly})
+	switch {
+	case errors.Is(err, ErrExecutionReverted):
+		return &ExecutionResult{ReturnData: output, GasUsed: f.gas.used, State: f.in.state, Err: err}
+	case err != nil:
+		f.gas.consume(f.gas.remaining())
+		return &ExecutionResult{GasUsed: f.gas.used, State: f.in.state, Err: err}
+	}
+	return &ExecutionResult{ReturnData: output, GasUsed: f.gas.used, State: f.in.state}
+}
+
+// depositCode checks the code that a creation frame which finished with res
+// deploys, and charges the frame for it. The creation fails, using up all its
+// gas, if the code is too large, starts with 0xEF since London (EIP-3541), or
+// cannot be paid for.
+func (f *callFrame) depositCode(res *ExecutionResult) {
+	if res.Failed() {
+		return
+	}
+	f.gas.used = res.GasUsed
+	code := res.ReturnData
+	switch {
+	case len(code) > maxCodeSize:
+		res.Err = fmt.Errorf("%w: %d bytes", ErrMaxCodeSizeExceeded, len(code))
+	case len(code) > 0 && code[0] == 0xEF && f.in.fork() >= London:
+		res.Err = ErrInvalidCode
+	default:
+		if err := f.gas.consume(gasCodeByte * uint64(len(code))); err != nil {
+			res.Err = fmt.Errorf("code deposit: %w", err)
+		}
+	}
+	if res.Failed() {
+		f.gas.used = f.gas.limit
+	}
+	res.GasUsed = f.gas.used
+}
+
+func (in *Interpreter) captureEnter(f *callFrame) {
+	if in.Tracer != nil {
+		in.Tracer.CaptureEnter(f.depth, opcodeTable[f.op].name, f.caller, f.address, f.input, f.gas.remaining(), f.value)
+	}
+}
+
+func (in *Interpreter) captureExit(f *callFrame, res *ExecutionResult) {
+	if in.Tracer != nil {
+		in.Tracer.CaptureExit(f.depth, res.ReturnData, res.GasUsed, res.Err)
+	}
+}
+
+// resume continues f after its sub-call child finished with res: the child's
+// unused gas is returned, its changes are reverted if it failed, and the
+// outcome is pushed on f's stack.
+func (f *callFrame) resume(child *callFrame, res *ExecutionResult) {
+	state, txCtx := f.in.state, f.in.txCtx
+	child.gas.used = res.GasUsed
+
+	switch child.op {
+	case 0xF0, 0xF5:
+		f.gas.settle(child.gas)
+
+		// Only a revert leaves return data: on success the output is the
+		// deployed code.
+		if errors.Is(res.Err, ErrExecutionReverted) {
+			f.returnData = res.ReturnData
+		}
+		if res.Failed() {
+			state.RevertToSnapshot(child.snapshot)
+			txCtx.journal.revert(child.ctxSnapshot)
+			f.stack.Push(new(Word))
+		} else {
+			state.SetCode(child.address, res.ReturnData)
+			f.stack.Push(child.address.Word())
+		}
+	default:
+		f.gas.settle(child.gas)
+		if res.Failed() {
+			state.RevertToSnapshot(child.snapshot)
+			txCtx.journal.revert(child.ctxSnapshot)
+		}
+		f.returnData = res.ReturnData
+
+		dataRet := f.returnData
+		if uint64(len(dataRet)) > child.retSize {
+			dataRet = dataRet[:child.retSize]
+		}
+		f.memory.Set(child.retOffset, dataRet)
+
+		if !res.Failed() {
+			f.stack.Push(NewWord(1))
+		} else {
+			f.stack.Push(new(Word))
+		}
+	}
+}
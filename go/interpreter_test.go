@@ -0,0 +1,245 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// recordingTracer records the frames an execution enters and leaves.
+type recordingTracer struct {
+	enters, exits []string
+	maxDepth      int
+	gas, gasUsed  []uint64
+	errs          []error
+}
+
+func (r *recordingTracer) CaptureEnter(depth int, op string, from, to Address, input []byte, gas uint64, value Word) {
+	r.enters = append(r.enters, op+" "+to.Hex())
+	r.gas = append(r.gas, gas)
+	if depth > r.maxDepth {
+		r.maxDepth = depth
+	}
+}
+
+func (r *recordingTracer) CaptureExit(depth int, output []byte, gasUsed uint64, err error) {
+	r.exits = append(r.exits, hex.EncodeToString(output))
+	r.gasUsed = append(r.gasUsed, gasUsed)
+	r.errs = append(r.errs, err)
+}
+
+func TestInterpreterTracer(t *testing.T) {
+	state := mustState(t, Accounts{
+		// RETURN the byte 0x2a.
+		"0xbb": {UserCode: usercode{Bin: "602a60005360016000f3"}},
+	})
+	tracer := &recordingTracer{}
+	in := &Interpreter{Tracer: tracer}
+
+	// STATICCALL 0xbb
+	bin, _ := hex.DecodeString("6000600060006000" + "60bb5afa")
+	res := in.Run(bin, Transaction{To: "0xcc"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Run(STATICCALL).Err = %v", res.Err)
+	}
+	wantEnters := []string{"CALL " + HexToAddress("0xcc").Hex(), "STATICCALL " + HexToAddress("0xbb").Hex()}
+	if len(tracer.enters) != 2 || tracer.enters[0] != wantEnters[0] || tracer.enters[1] != wantEnters[1] {
+		t.Errorf("entered %q; want %q", tracer.enters, wantEnters)
+	}
+	// The callee exits first.
+	if len(tracer.exits) != 2 || tracer.exits[0] != "2a" || tracer.exits[1] != "" {
+		t.Errorf("exited with %q; want [\"2a\" \"\"]", tracer.exits)
+	}
+	if tracer.maxDepth != 1 {
+		t.Errorf("max depth = %d; want 1", tracer.maxDepth)
+	}
+}
+
+func TestInterpreterMaxCallDepth(t *testing.T) {
+	// A contract that calls itself with all of its gas, forever. Each level
+	// passes on 63/64 of its gas, so reaching the limit takes plenty.
+	self := HexToAddress("0xcc")
+	recurse := "60006000600060006000305af1"
+	state := mustState(t, Accounts{self.Hex(): {UserCode: usercode{Bin: recurse}}})
+	tracer := &recordingTracer{}
+	in := &Interpreter{Tracer: tracer}
+
+	bin, _ := hex.DecodeString(recurse)
+	res := in.Run(bin, Transaction{To: self.Hex(), Gas: "0xffffffffff"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Run(recursive CALL).Err = %v", res.Err)
+	}
+	// The call beyond the limit is refused before a frame is entered.
+	if tracer.maxDepth != maxCallDepth {
+		t.Errorf("max depth entered = %d; want %d", tracer.maxDepth, maxCallDepth)
+	}
+	if len(tracer.enters) != len(tracer.exits) {
+		t.Errorf("%d frames entered, %d exited", len(tracer.enters), len(tracer.exits))
+	}
+	for i, err := range tracer.errs {
+		if err != nil {
+			t.Errorf("exit %d error = %v; want nil", i, err)
+		}
+	}
+}
+
+func TestInterpreterMaxCallDepthCreate(t *testing.T) {
+	// A contract that creates an empty contract, then calls itself with all
+	// of its gas, forever. The CREATE of the deepest frame is refused without
+	// using up a nonce.
+	self := HexToAddress("0xcc")
+	recurse := "600060006000f050" + "60006000600060006000305af1"
+	state := mustState(t, Accounts{self.Hex(): {UserCode: usercode{Bin: recurse}}})
+
+	bin, _ := hex.DecodeString(recurse)
+	res := (&Interpreter{}).Run(bin, Transaction{To: self.Hex(), Gas: "0xffffffffffff"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Run(recursive CREATE).Err = %v", res.Err)
+	}
+	if nonce := res.State.GetNonce(self); nonce != maxCallDepth {
+		t.Errorf("nonce = %d; want %d", nonce, maxCallDepth)
+	}
+}
+
+func TestInterpreterTracerCodeDeposit(t *testing.T) {
+	// CREATE with init code that returns 100 bytes of code, which its 740 or
+	// so gas cannot pay to deposit.
+	tracer := &recordingTracer{}
+	bin, _ := hex.DecodeString("6460646000f3" + "600052" + "6005601b6000f0")
+	res := (&Interpreter{Tracer: tracer}).Run(bin, Transaction{Gas: "0x8000"}, BlockContext{}, nil)
+	if res.Failed() {
+		t.Fatalf("Run(CREATE).Err = %v", res.Err)
+	}
+	if !res.Stack[0].IsZero() {
+		t.Errorf("CREATE pushed %s; want 0x0", res.Stack[0].Hex())
+	}
+	// The creation exits first, failing and using up all its gas.
+	if len(tracer.errs) != 2 || !errors.Is(tracer.errs[0], ErrOutOfGas) {
+		t.Fatalf("exit errors %v; want the first to be %v", tracer.errs, ErrOutOfGas)
+	}
+	if tracer.gasUsed[0] != tracer.gas[1] {
+		t.Errorf("creation used %d gas; want all of its %d", tracer.gasUsed[0], tracer.gas[1])
+	}
+}
+
+func TestInterpreterCreationRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		fork     Fork
+		initCode string
+		wantErr  error // of the creation
+	}{
+		{"0xEF code (Berlin)", Berlin, "60ef60005360016000f3", nil},
+		{"0xEF code (London)", London, "60ef60005360016000f3", ErrInvalidCode},
+		{"0xFE code (London)", London, "60fe60005360016000f3", nil},
+		{"max code size", Cancun, "6160006000f3", nil},
+		{"code too large (Berlin)", Berlin, "6160016000f3", ErrMaxCodeSizeExceeded},
+		{"code too large (Cancun)", Cancun, "6160016000f3", ErrMaxCodeSizeExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Store the init code at the end of the first word of memory and
+			// CREATE from it.
+			n := len(tt.initCode) / 2
+			bin, _ := hex.DecodeString(fmt.Sprintf("%02x%s600052"+"60%02x60%02x6000f0", 0x5f+n, tt.initCode, n, 32-n))
+			tracer := &recordingTracer{}
+			res := (&Interpreter{Fork: tt.fork, Tracer: tracer}).Run(bin, Transaction{Gas: "0x1000000"}, BlockContext{}, nil)
+			if res.Failed() {
+				t.Fatalf("Run(CREATE).Err = %v", res.Err)
+			}
+			if !errors.Is(tracer.errs[0], tt.wantErr) {
+				t.Fatalf("creation error %v; want %v", tracer.errs[0], tt.wantErr)
+			}
+			if created := !res.Stack[0].IsZero(); created != (tt.wantErr == nil) {
+				t.Errorf("CREATE pushed %s; want a new address: %t", res.Stack[0].Hex(), tt.wantErr == nil)
+			}
+			if tt.wantErr != nil && tracer.gasUsed[0] != tracer.gas[1] {
+				t.Errorf("creation used %d gas; want all of its %d", tracer.gasUsed[0], tracer.gas[1])
+			}
+		})
+	}
+}
+
+func TestInterpreterMaxInitCodeSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		fork    Fork
+		bin     string
+		wantErr error
+	}{
+		{"CREATE (max size)", Shanghai, "61c00060006000f0", nil},
+		{"CREATE (too large)", Shanghai, "61c00160006000f0", ErrMaxInitCodeSizeExceeded},
+		{"CREATE2 (too large)", Cancun, "600061c00160006000f5", ErrMaxInitCodeSizeExceeded},
+		{"CREATE (too large, Paris)", Paris, "61c00160006000f0", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, _ := hex.DecodeString(tt.bin)
+			res := (&Interpreter{Fork: tt.fork}).Run(bin, Transaction{}, BlockContext{}, nil)
+			if !errors.Is(res.Err, tt.wantErr) {
+				t.Fatalf("Run(%s).Err = %v; want %v", tt.bin, res.Err, tt.wantErr)
+			}
+			if tt.wantErr == nil && res.Stack[0].IsZero() {
+				t.Errorf("Run(%s) created nothing", tt.bin)
+			}
+		})
+	}
+}
+
+func TestInterpreterForkOpcodes(t *testing.T) {
+	Block := BlockContext{Basefee: "0x7", Difficulty: "0x20000", PrevRandao: "0x1234", BlobBaseFee: "0x3"}
+	transaction := Transaction{BlobHashes: []string{"0x01aa", "0x01bb"}}
+	tests := []struct {
+		name    string
+		fork    Fork
+		bin     string
+		want    string // top of the stack
+		wantErr error
+	}{
+		{"BASEFEE (Berlin)", Berlin, "48", "", ErrInvalidOpcode},
+		{"BASEFEE (London)", London, "48", "0x7", nil},
+		{"DIFFICULTY (London)", London, "44", "0x20000", nil},
+		{"PREVRANDAO (Paris)", Paris, "44", "0x1234", nil},
+		{"PUSH0 (Paris)", Paris, "5f", "", ErrInvalidOpcode},
+		{"PUSH0 (Shanghai)", Shanghai, "5f", "0x0", nil},
+		{"PUSH0 (latest)", 0, "5f", "0x0", nil},
+		{"TLOAD (Shanghai)", Shanghai, "5f5c", "", ErrInvalidOpcode},
+		{"TSTORE (Shanghai)", Shanghai, "5f5f5d", "", ErrInvalidOpcode},
+		{"MCOPY (Shanghai)", Shanghai, "5f5f5f5e", "", ErrInvalidOpcode},
+		{"TLOAD (Cancun)", Cancun, "5f5c", "0x0", nil},
+		{"BLOBHASH (Shanghai)", Shanghai, "5f49", "", ErrInvalidOpcode},
+		{"BLOBHASH (Cancun)", Cancun, "600149", "0x1bb", nil},
+		{"BLOBHASH (past the blobs)", Cancun, "600249", "0x0", nil},
+		{"BLOBBASEFEE (Shanghai)", Shanghai, "4a", "", ErrInvalidOpcode},
+		{"BLOBBASEFEE (Cancun)", Cancun, "4a", "0x3", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, _ := hex.DecodeString(tt.bin)
+			res := (&Interpreter{Fork: tt.fork}).Run(bin, transaction, Block, nil)
+			if !errors.Is(res.Err, tt.wantErr) {
+				t.Fatalf("Run(%s).Err = %v; want %v", tt.bin, res.Err, tt.wantErr)
+			}
+			if tt.wantErr == nil && res.Stack[0].Hex() != tt.want {
+				t.Errorf("Run(%s) = %s; want %s", tt.bin, res.Stack[0].Hex(), tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpreterChainConfig(t *testing.T) {
+	zero := newUint64(0)
+	in := &Interpreter{Config: &ChainConfig{LondonBlock: zero, ParisBlock: zero, ShanghaiTime: newUint64(100)}}
+	push0, _ := hex.DecodeString("5f")
+	// PUSH0 only exists once Shanghai is active, at timestamp 100.
+	if res := in.Run(push0, Transaction{}, BlockContext{Timestamp: "0x63"}, nil); !errors.Is(res.Err, ErrInvalidOpcode) {
+		t.Errorf("Run(PUSH0) at 99 = %v; want ErrInvalidOpcode", res.Err)
+	}
+	if res := in.Run(push0, Transaction{}, BlockContext{Timestamp: "0x64"}, nil); res.Failed() {
+		t.Errorf("Run(PUSH0) at 100 = %v; want success", res.Err)
+	}
+	if res := (&Interpreter{Fork: Cancun + 1}).Run(push0, Transaction{}, BlockContext{}, nil); res.Err == nil {
+		t.Errorf("Run with an unknown fork succeeded")
+	}
+}
@@ -0,0 +1,27 @@
+package evm
+
+// journal is an undo log. Every change made to a journaled structure appends a
+// function that undoes it, so that the changes made since a snapshot can be
+// reverted in reverse order.
+type journal struct {
+	undo []func()
+}
+
+// append records the undo function of a change.
+func (j *journal) append(undo func()) {
+	j.undo = append(j.undo, undo)
+}
+
+// snapshot returns an identifier for the current point in the log.
+func (j *journal) snapshot() int {
+	return len(j.undo)
+}
+
+// revert undoes every change made since snapshot id was taken. Snapshots taken
+// after id become invalid.
+func (j *journal) revert(id int) {
+	for i := len(j.undo) - 1; i >= id; i-- {
+		j.undo[i]()
+	}
+	j.undo = j.undo[:id]
+}
@@ -0,0 +1,97 @@
+package evm
+
+import "fmt"
+
+// maxMemorySize is the largest memory, in bytes, that an execution may use. It
+// is far beyond what any gas limit can pay for, and keeps the quadratic term of
+// the expansion cost from overflowing.
+const maxMemorySize = 0x1FFFFFFFE0
+
+// Memory is the byte-addressed memory of a call frame. It starts empty and
+// grows in 32-byte words as it is accessed; bytes that were never written read
+// as zero.
+//
+// Like Stack, the accessors do not check bounds themselves: an access must
+// first be priced with Require and the memory grown with Resize.
+type Memory struct {
+	data []byte
+}
+
+// NewMemory returns an empty memory.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Len returns the size of the memory in bytes, always a multiple of 32. This is
+// what MSIZE reports.
+func (m *Memory) Len() uint64 {
+	return uint64(len(m.data))
+}
+
+// memoryGasCost returns the total cost of a memory of the given number of
+// words: linear in the size, plus a quadratic term that makes large memories
+// prohibitively expensive.
+func memoryGasCost(words uint64) uint64 {
+	return words*gasMemory + words*words/gasQuadDiv
+}
+
+// Require returns the size the memory must be resized to for an access of size
+// bytes at offset, and the gas cost of growing it. An access of zero bytes
+// needs no memory, whatever the offset. Regions reaching beyond maxMemorySize
+// are rejected with ErrMemoryOutOfBounds.
+func (m *Memory) Require(offset, size *Word) (newSize, cost uint64, err error) {
+	if size.IsZero() {
+		return m.Len(), 0, nil
+	}
+	if !offset.IsUint64() || !size.IsUint64() || offset.Uint64() > maxMemorySize || size.Uint64() > maxMemorySize-offset.Uint64() {
+		return 0, 0, fmt.Errorf("%w: offset %s, size %s", ErrMemoryOutOfBounds, offset.Hex(), size.Hex())
+	}
+	end := offset.Uint64() + size.Uint64()
+	if end <= m.Len() {
+		return m.Len(), 0, nil
+	}
+	newSize = toWordSize(end) * 32
+	return newSize, memoryGasCost(newSize/32) - memoryGasCost(m.Len()/32), nil
+}
+
+// Resize grows the memory to size bytes. It never shrinks it.
+func (m *Memory) Resize(size uint64) {
+	if size > m.Len() {
+		m.data = append(m.data, make([]byte, size-m.Len())...)
+	}
+}
+
+// Set copies value into memory at offset.
+func (m *Memory) Set(offset uint64, value []byte) {
+	if len(value) > 0 {
+		copy(m.data[offset:], value)
+	}
+}
+
+// Set32 stores w as a 32-byte big-endian word at offset, as MSTORE does.
+func (m *Memory) Set32(offset uint64, w *Word) {
+	b := w.Bytes32()
+	copy(m.data[offset:], b[:])
+}
+
+// SetByte stores a single byte at offset, as MSTORE8 does.
+func (m *Memory) SetByte(offset uint64, b byte) {
+	m.data[offset] = b
+}
+
+// View returns the size bytes at offset. The slice aliases the memory, so it
+// is only valid until the next write; callers that keep it must copy it.
+func (m *Memory) View(offset, size uint64) []byte {
+	if size == 0 {
+		return nil
+	}
+	return m.data[offset : offset+size]
+}
+
+// Copy returns a copy of the size bytes at offset.
+func (m *Memory) Copy(offset, size uint64) []byte {
+	if size == 0 {
+		return nil
+	}
+	return append([]byte(nil), m.data[offset:offset+size]...)
+}
@@ -0,0 +1,79 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestMemoryRequire(t *testing.T) {
+	m := NewMemory()
+	tests := []struct {
+		offset, size  string
+		newSize, cost uint64
+	}{
+		{"0x0", "0x0", 0, 0},
+		{"0xffffffffffffffffffffffff", "0x0", 0, 0},
+		{"0x0", "0x1", 32, 3},
+		{"0x1f", "0x2", 64, 6},
+		{"0x0", "0x400", 1024, 32*3 + 32*32/512},
+	}
+	for _, tt := range tests {
+		newSize, cost, err := m.Require(hexToWord(tt.offset), hexToWord(tt.size))
+		if err != nil || newSize != tt.newSize || cost != tt.cost {
+			t.Errorf("Require(%s, %s) = %d, %d, %v; want %d, %d, nil", tt.offset, tt.size, newSize, cost, err, tt.newSize, tt.cost)
+		}
+	}
+
+	m.Resize(64)
+	if newSize, cost, _ := m.Require(NewWord(0), NewWord(64)); newSize != 64 || cost != 0 {
+		t.Errorf("Require within memory = %d, %d; want 64, 0", newSize, cost)
+	}
+	if _, cost, _ := m.Require(NewWord(64), NewWord(1)); cost != 3*3+3*3/512-2*3 {
+		t.Errorf("Require past memory cost = %d; want the difference to 3 words", cost)
+	}
+	for _, region := range [][2]string{{"0x10000000000000000", "0x1"}, {"0x0", "0x10000000000000000"}, {"0xffffffffffffffff", "0x1"}} {
+		if _, _, err := m.Require(hexToWord(region[0]), hexToWord(region[1])); !errors.Is(err, ErrMemoryOutOfBounds) {
+			t.Errorf("Require(%s, %s) error %v; want %v", region[0], region[1], err, ErrMemoryOutOfBounds)
+		}
+	}
+}
+
+func TestEvmMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		bin     string
+		gas     string
+		want    string // top of the stack
+		wantErr error
+	}{
+		{"MSTORE8 then MSIZE", "60ff60205359", "", "0x40", nil},
+		{"MSTORE past 1024 bytes", "60ff61100052611000515059", "", "0x1020", nil},
+		{"MLOAD past 1024 bytes", "61200051", "", "0x0", nil},
+		{"SHA3 of nothing far away", "60007fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff2059", "", "0x0", nil},
+		{"MLOAD (offset too large)", "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff51", "", "", ErrMemoryOutOfBounds},
+		{"RETURN (size too large)", "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff6000f3", "", "", ErrMemoryOutOfBounds},
+		{"CALLDATACOPY (size too large)", "67ffffffffffffffff600060003750", "", "", ErrMemoryOutOfBounds},
+		// Expanding memory to 4 MB costs 33,947,648 gas: more than the
+		// default gas limit, but a block may allow more.
+		{"MSTORE up to 4 MB", "600162" + "3fffe0" + "5259", "", "", ErrOutOfGas},
+		{"MSTORE up to 4 MB (60M gas)", "600162" + "3fffe0" + "5259", "0x3938700", "0x400000", nil},
+		// Gas runs out before any memory is allocated.
+		{"MSTORE at 64 GiB", "6001641000000000" + "52", "", "", ErrOutOfGas},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, err := hex.DecodeString(tt.bin)
+			if err != nil {
+				t.Fatalf("hex.DecodeString(%q) error %v", tt.bin, err)
+			}
+			res := Evm(bin, Transaction{Gas: tt.gas}, BlockContext{}, nil)
+			if !errors.Is(res.Err, tt.wantErr) {
+				t.Fatalf("Evm(%s).Err = %v; want %v", tt.bin, res.Err, tt.wantErr)
+			}
+			if tt.wantErr == nil && res.Stack[0].Hex() != tt.want {
+				t.Errorf("Evm(%s) top of stack = %s; want %s", tt.bin, res.Stack[0].Hex(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package evm
+
+import "fmt"
+
+// operation describes an opcode: its mnemonic, how many items it takes from
+// and puts on the stack, and its constant gas cost. The interpreter checks the
+// stack requirements and charges the constant gas before running an
+// instruction; costs that depend on the operands are charged by the
+// instruction itself.
+type operation struct {
+	name        string
+	pops        int
+	pushes      int
+	constantGas uint64
+}
+
+// defined reports whether op is a known instruction. Bytes without an entry
+// in the jump table, including the designated INVALID (0xFE), are invalid.
+func (op *operation) defined() bool {
+	return op.name != ""
+}
+
+// jumpTable is the instruction set of a fork, indexed by opcode.
+type jumpTable [256]operation
+
+// opcodeTable is the instruction set of Berlin, the earliest fork supported.
+// The instructions of later forks are in forkOperations.
+var opcodeTable = jumpTable{
+	0x00: {"STOP", 0, 0, gasZero},
+	0x01: {"ADD", 2, 1, gasFastestStep},
+	0x02: {"MUL", 2, 1, gasFastStep},
+	0x03: {"SUB", 2, 1, gasFastestStep},
+	0x04: {"DIV", 2, 1, gasFastStep},
+	0x05: {"SDIV", 2, 1, gasFastStep},
+	0x06: {"MOD", 2, 1, gasFastStep},
+	0x07: {"SMOD", 2, 1, gasFastStep},
+	0x08: {"ADDMOD", 3, 1, gasMidStep},
+	0x09: {"MULMOD", 3, 1, gasMidStep},
+	0x0A: {"EXP", 2, 1, gasSlowStep},
+	0x0B: {"SIGNEXTEND", 2, 1, gasFastStep},
+
+	0x10: {"LT", 2, 1, gasFastestStep},
+	0x11: {"GT", 2, 1, gasFastestStep},
+	0x12: {"SLT", 2, 1, gasFastestStep},
+	0x13: {"SGT", 2, 1, gasFastestStep},
+	0x14: {"EQ", 2, 1, gasFastestStep},
+	0x15: {"ISZERO", 1, 1, gasFastestStep},
+	0x16: {"AND", 2, 1, gasFastestStep},
+	0x17: {"OR", 2, 1, gasFastestStep},
+	0x18: {"XOR", 2, 1, gasFastestStep},
+	0x19: {"NOT", 1, 1, gasFastestStep},
+	0x1A: {"BYTE", 2, 1, gasFastestStep},
+	0x1B: {"SHL", 2, 1, gasFastestStep},
+	0x1C: {"SHR", 2, 1, gasFastestStep},
+	0x1D: {"SAR", 2, 1, gasFastestStep},
+
+	0x20: {"SHA3", 2, 1, gasSha3},
+
+	0x30: {"ADDRESS", 0, 1, gasQuickStep},
+	0x31: {"BALANCE", 1, 1, gasZero},
+	0x32: {"ORIGIN", 0, 1, gasQuickStep},
+	0x33: {"CALLER", 0, 1, gasQuickStep},
+	0x34: {"CALLVALUE", 0, 1, gasQuickStep},
+	0x35: {"CALLDATALOAD", 1, 1, gasFastestStep},
+	0x36: {"CALLDATASIZE", 0, 1, gasQuickStep},
+	0x37: {"CALLDATACOPY", 3, 0, gasFastestStep},
+	0x38: {"CODESIZE", 0, 1, gasQuickStep},
+	0x39: {"CODECOPY", 3, 0, gasFastestStep},
+	0x3A: {"GASPRICE", 0, 1, gasQuickStep},
+	0x3B: {"EXTCODESIZE", 1, 1, gasZero},
+	0x3C: {"EXTCODECOPY", 4, 0, gasZero},
+	0x3D: {"RETURNDATASIZE", 0, 1, gasQuickStep},
+	0x3E: {"RETURNDATACOPY", 3, 0, gasFastestStep},
+	0x3F: {"EXTCODEHASH", 1, 1, gasZero},
+
+	0x40: {"BLOCKHASH", 1, 1, gasExtStep},
+	0x41: {"COINBASE", 0, 1, gasQuickStep},
+	0x42: {"TIMESTAMP", 0, 1, gasQuickStep},
+	0x43: {"NUMBER", 0, 1, gasQuickStep},
+	0x44: {"DIFFICULTY", 0, 1, gasQuickStep},
+	0x45: {"GASLIMIT", 0, 1, gasQuickStep},
+	0x46: {"CHAINID", 0, 1, gasQuickStep},
+	0x47: {"SELFBALANCE", 0, 1, gasFastStep},
+
+	0x50: {"POP", 1, 0, gasQuickStep},
+	0x51: {"MLOAD", 1, 1, gasFastestStep},
+	0x52: {"MSTORE", 2, 0, gasFastestStep},
+	0x53: {"MSTORE8", 2, 0, gasFastestStep},
+	0x54: {"SLOAD", 1, 1, gasZero},
+	0x55: {"SSTORE", 2, 0, gasZero},
+	0x56: {"JUMP", 1, 0, gasMidStep},
+	0x57: {"JUMPI", 2, 0, gasSlowStep},
+	0x58: {"PC", 0, 1, gasQuickStep},
+	0x59: {"MSIZE", 0, 1, gasQuickStep},
+	0x5A: {"GAS", 0, 1, gasQuickStep},
+	0x5B: {"JUMPDEST", 0, 0, gasJumpdest},
+
+	0xA0: {"LOG0", 2, 0, gasLog},
+	0xA1: {"LOG1", 3, 0, gasLog},
+	0xA2: {"LOG2", 4, 0, gasLog},
+	0xA3: {"LOG3", 5, 0, gasLog},
+	0xA4: {"LOG4", 6, 0, gasLog},
+
+	0xF0: {"CREATE", 3, 1, gasCreate},
+	0xF1: {"CALL", 7, 1, gasZero},
+	0xF2: {"CALLCODE", 7, 1, gasZero},
+	0xF3: {"RETURN", 2, 0, gasZero},
+	0xF4: {"DELEGATECALL", 6, 1, gasZero},
+	0xF5: {"CREATE2", 4, 1, gasCreate},
+	0xFA: {"STATICCALL", 6, 1, gasZero},
+	0xFD: {"REVERT", 2, 0, gasZero},
+	0xFF: {"SELFDESTRUCT", 1, 0, gasSelfdest},
+}
+
+// forkOperations are the instructions that later forks add, or rename.
+var forkOperations = []struct {
+	fork      Fork
+	op        byte
+	operation operation
+}{
+	{London, 0x48, operation{"BASEFEE", 0, 1, gasQuickStep}},     // EIP-3198
+	{Paris, 0x44, operation{"PREVRANDAO", 0, 1, gasQuickStep}},   // EIP-4399
+	{Shanghai, 0x5F, operation{"PUSH0", 0, 1, gasQuickStep}},     // EIP-3855
+	{Cancun, 0x5C, operation{"TLOAD", 1, 1, gasWarmAccess}},      // EIP-1153
+	{Cancun, 0x5D, operation{"TSTORE", 2, 0, gasWarmAccess}},     // EIP-1153
+	{Cancun, 0x5E, operation{"MCOPY", 3, 0, gasFastestStep}},     // EIP-5656
+	{Cancun, 0x49, operation{"BLOBHASH", 1, 1, gasFastestStep}},  // EIP-4844
+	{Cancun, 0x4A, operation{"BLOBBASEFEE", 0, 1, gasQuickStep}}, // EIP-7516
+}
+
+// jumpTables are the instruction sets of each fork.
+var jumpTables = map[Fork]*jumpTable{}
+
+// newJumpTable returns the instruction set of fork.
+func newJumpTable(fork Fork) *jumpTable {
+	jt := opcodeTable
+	for _, o := range forkOperations {
+		if fork >= o.fork {
+			jt[o.op] = o.operation
+		}
+	}
+	return &jt
+}
+
+func init() {
+	for i := 1; i <= 32; i++ {
+		opcodeTable[0x5F+i] = operation{fmt.Sprintf("PUSH%d", i), 0, 1, gasFastestStep}
+	}
+	for i := 1; i <= 16; i++ {
+		opcodeTable[0x7F+i] = operation{fmt.Sprintf("DUP%d", i), i, i + 1, gasFastestStep}
+		opcodeTable[0x8F+i] = operation{fmt.Sprintf("SWAP%d", i), i + 1, i + 1, gasFastestStep}
+	}
+	for fork := range forkNames {
+		jumpTables[fork] = newJumpTable(fork)
+	}
+}
@@ -0,0 +1,468 @@
+package evm
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/big"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Precompile is a contract implemented in Go rather than EVM code. Calls to
+// its address run it instead of any code stored there.
+type Precompile interface {
+	// Gas returns the cost of running the contract on input.
+	Gas(input []byte) uint64
+	// Run returns the output of the contract for call. An error fails the
+	// call, using up all of its gas, unless it is ErrExecutionReverted: then
+	// the call reverts with the output as its return data, and the unused gas
+	// is returned to the caller.
+	Run(call PrecompileCall) ([]byte, error)
+}
+
+// PrecompileCall is a call to a Precompile. Under DELEGATECALL, Caller and
+// Value are those of the calling frame.
+type PrecompileCall struct {
+	Input    []byte
+	Caller   Address
+	Value    Word
+	ReadOnly bool // set under STATICCALL; the contract must not change state
+}
+
+// activePrecompiles returns the precompiles of fork, by address: the built-in
+// ones, and custom, which take precedence over them.
+func activePrecompiles(fork Fork, custom map[Address]Precompile) map[Address]Precompile {
+	active := make(map[Address]Precompile, len(precompiles)+len(forkPrecompiles)+len(custom))
+	for addr, p := range precompiles {
+		active[addr] = builtinPrecompile{p}
+	}
+	for _, p := range forkPrecompiles {
+		if fork >= p.fork {
+			active[p.addr] = builtinPrecompile{p.precompile}
+		}
+	}
+	for addr, p := range custom {
+		active[addr] = p
+	}
+	return active
+}
+
+// builtinPrecompile adapts a built-in precompile, which only sees its input,
+// to Precompile.
+type builtinPrecompile struct {
+	p precompile
+}
+
+func (b builtinPrecompile) Gas(input []byte) uint64 {
+	return b.p.gas(input)
+}
+
+func (b builtinPrecompile) Run(call PrecompileCall) ([]byte, error) {
+	return b.p.run(call.Input)
+}
+
+// precompile is a built-in precompiled contract.
+type precompile interface {
+	// gas returns the cost of running the contract on input.
+	gas(input []byte) uint64
+	// run returns the output of the contract for input. An error fails the
+	// call, using up all of its gas.
+	run(input []byte) ([]byte, error)
+}
+
+// precompiles are the precompiled contracts of every supported fork, by
+// address. Those of later forks are in forkPrecompiles.
+var precompiles = map[Address]precompile{
+	HexToAddress("0x1"): ecrecover{},
+	HexToAddress("0x2"): sha256Hash{},
+	HexToAddress("0x3"): ripemd160Hash{},
+	HexToAddress("0x4"): identity{},
+	HexToAddress("0x5"): modExp{},
+	HexToAddress("0x6"): ecAdd{},
+	HexToAddress("0x7"): ecMul{},
+	HexToAddress("0x8"): ecPairing{},
+	HexToAddress("0x9"): blake2F{},
+}
+
+// forkPrecompiles are the precompiled contracts that later forks add.
+var forkPrecompiles = []struct {
+	fork       Fork
+	addr       Address
+	precompile precompile
+}{
+	{Cancun, HexToAddress("0xa"), pointEvaluation{}}, // EIP-4844
+}
+
+// ecrecover recovers the address that signed a hash. The input is the hash,
+// v, r and s, each as a 32-byte word, and the output the address as a word.
+// An invalid signature gives no output, but does not fail the call.
+type ecrecover struct{}
+
+func (ecrecover) gas(input []byte) uint64 {
+	return gasEcrecover
+}
+
+func (ecrecover) run(input []byte) ([]byte, error) {
+	input = getData(input, new(Word), 128)
+	v := new(big.Int).SetBytes(input[32:64])
+	if !v.IsUint64() || (v.Uint64() != 27 && v.Uint64() != 28) {
+		return nil, nil
+	}
+	hash := new(big.Int).SetBytes(input[:32])
+	r, s := new(big.Int).SetBytes(input[64:96]), new(big.Int).SetBytes(input[96:128])
+	pub := secp256k1Recover(hash, r, s, v.Uint64() == 28)
+	if pub == nil {
+		return nil, nil
+	}
+	// The address is the last 20 bytes of the hash of the public key.
+	var key [64]byte
+	pub.x.FillBytes(key[:32])
+	pub.y.FillBytes(key[32:])
+	hashed := keccak256Word(key[:])
+	address := wordToAddress(&hashed)
+	out := address.Word().Bytes32()
+	return out[:], nil
+}
+
+// secp256k1 is the curve Ethereum signatures are made on, and
+// secp256k1G and secp256k1N the generator of its group and the group's order.
+var (
+	secp256k1  = &shortCurve{p: mustParseBig("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"), b: big.NewInt(7)}
+	secp256k1G = &curvePoint{
+		x: mustParseBig("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		y: mustParseBig("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+	}
+	secp256k1N = mustParseBig("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+)
+
+// secp256k1Recover returns the public key that made the signature (r, s) of
+// hash, where odd is the parity of the y coordinate of the signature's curve
+// point. It returns nil if there is no such key.
+func secp256k1Recover(hash, r, s *big.Int, odd bool) *curvePoint {
+	n := secp256k1N
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(n) >= 0 {
+		return nil
+	}
+	// R is the point with x coordinate r and the given parity.
+	y := new(big.Int).ModSqrt(secp256k1.rhs(r), secp256k1.p)
+	if y == nil {
+		return nil
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(secp256k1.p, y)
+	}
+	R := &curvePoint{x: r, y: y}
+
+	// The key is r⁻¹(sR - hash·G).
+	rInv := new(big.Int).ModInverse(r, n)
+	u1 := new(big.Int).Neg(hash)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, n)
+	return secp256k1.add(secp256k1.scalarMult(secp256k1G, u1), secp256k1.scalarMult(R, u2))
+}
+
+// mustParseBig parses a hex number, for constants.
+func mustParseBig(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid hex number " + s)
+	}
+	return n
+}
+
+// sha256Hash returns the SHA-256 hash of its input.
+type sha256Hash struct{}
+
+func (sha256Hash) gas(input []byte) uint64 {
+	return gasSha256Base + gasSha256Word*toWordSize(uint64(len(input)))
+}
+
+func (sha256Hash) run(input []byte) ([]byte, error) {
+	hash := sha256.Sum256(input)
+	return hash[:], nil
+}
+
+// ripemd160Hash returns the RIPEMD-160 hash of its input, left-padded to 32
+// bytes.
+type ripemd160Hash struct{}
+
+func (ripemd160Hash) gas(input []byte) uint64 {
+	return gasRipemd160Base + gasRipemd160Word*toWordSize(uint64(len(input)))
+}
+
+func (ripemd160Hash) run(input []byte) ([]byte, error) {
+	hash := ripemd160.New()
+	hash.Write(input)
+	return append(make([]byte, 12), hash.Sum(nil)...), nil
+}
+
+// identity returns its input.
+type identity struct{}
+
+func (identity) gas(input []byte) uint64 {
+	return gasIdentityBase + gasIdentityWord*toWordSize(uint64(len(input)))
+}
+
+func (identity) run(input []byte) ([]byte, error) {
+	return append([]byte(nil), input...), nil
+}
+
+// modExp computes base^exp mod mod (EIP-198). The input is the lengths of
+// base, exp and mod as 32-byte words, followed by the three numbers, big-endian;
+// missing input reads as zeros. The output is the result, mod-length bytes long.
+type modExp struct{}
+
+// maxModExpLen is the largest length of a MODEXP operand, in bytes. It is far
+// beyond what any gas limit can pay for.
+const maxModExpLen = 1 << 32
+
+// lengths returns the lengths of base, exp and mod.
+func (modExp) lengths(input []byte) (base, exp, mod *big.Int) {
+	input = getData(input, new(Word), 96)
+	return new(big.Int).SetBytes(input[:32]), new(big.Int).SetBytes(input[32:64]), new(big.Int).SetBytes(input[64:96])
+}
+
+// gas follows EIP-2565: the cost of multiplying numbers of the larger of the
+// base and mod lengths, times the number of squarings the exponent needs.
+func (m modExp) gas(input []byte) uint64 {
+	baseLen, expLen, modLen := m.lengths(input)
+
+	words := baseLen
+	if modLen.Cmp(words) > 0 {
+		words = modLen
+	}
+	words = new(big.Int).Add(words, big.NewInt(7))
+	words.Rsh(words, 3)
+	complexity := words.Mul(words, words)
+
+	// The iteration count depends on the first 32 bytes of the exponent.
+	headLen := uint64(32)
+	if expLen.IsUint64() && expLen.Uint64() < headLen {
+		headLen = expLen.Uint64()
+	}
+	start := new(big.Int).Add(baseLen, big.NewInt(96))
+	head := new(big.Int)
+	if start.IsUint64() {
+		head.SetBytes(getData(input, NewWord(start.Uint64()), headLen))
+	}
+	iterations := new(big.Int)
+	if expLen.Cmp(big.NewInt(32)) > 0 {
+		iterations.Sub(expLen, big.NewInt(32))
+		iterations.Lsh(iterations, 3)
+	}
+	if head.BitLen() > 1 {
+		iterations.Add(iterations, big.NewInt(int64(head.BitLen()-1)))
+	}
+	if iterations.Sign() == 0 {
+		iterations.SetInt64(1)
+	}
+
+	gas := complexity.Mul(complexity, iterations)
+	gas.Div(gas, big.NewInt(3))
+	if !gas.IsUint64() {
+		return math.MaxUint64
+	}
+	if gas.Uint64() < gasModExpMin {
+		return gasModExpMin
+	}
+	return gas.Uint64()
+}
+
+func (m modExp) run(input []byte) ([]byte, error) {
+	baseLen, expLen, modLen := m.lengths(input)
+	if baseLen.Sign() == 0 && modLen.Sign() == 0 {
+		return nil, nil
+	}
+	// The gas already charged keeps the lengths in check; the bound only
+	// guards the offsets below against overflow.
+	for _, n := range []*big.Int{baseLen, expLen, modLen} {
+		if !n.IsUint64() || n.Uint64() > maxModExpLen {
+			return nil, fmt.Errorf("%w: modexp operand of %s bytes", ErrPrecompileInput, n)
+		}
+	}
+	bl, el, ml := baseLen.Uint64(), expLen.Uint64(), modLen.Uint64()
+	base := new(big.Int).SetBytes(getData(input, NewWord(96), bl))
+	exp := new(big.Int).SetBytes(getData(input, NewWord(96+bl), el))
+	mod := new(big.Int).SetBytes(getData(input, NewWord(96+bl+el), ml))
+
+	out := make([]byte, ml)
+	if mod.Sign() == 0 {
+		return out, nil
+	}
+	return new(big.Int).Exp(base, exp, mod).FillBytes(out), nil
+}
+
+// ecAdd adds two points of the BN254 curve G1 (EIP-196). Each point is its x
+// and y coordinates as 32-byte words, (0, 0) being the point at infinity.
+// Points not on the curve fail the call.
+type ecAdd struct{}
+
+func (ecAdd) gas(input []byte) uint64 {
+	return gasEcAdd
+}
+
+func (ecAdd) run(input []byte) ([]byte, error) {
+	input = getData(input, new(Word), 128)
+	a, err := decodeG1(input[:64])
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeG1(input[64:])
+	if err != nil {
+		return nil, err
+	}
+	return encodeG1(bn254G1.add(a, b)), nil
+}
+
+// ecMul multiplies a point of the BN254 curve G1, encoded as for ecAdd, by a
+// 32-byte scalar.
+type ecMul struct{}
+
+func (ecMul) gas(input []byte) uint64 {
+	return gasEcMul
+}
+
+func (ecMul) run(input []byte) ([]byte, error) {
+	input = getData(input, new(Word), 96)
+	a, err := decodeG1(input[:64])
+	if err != nil {
+		return nil, err
+	}
+	return encodeG1(bn254G1.scalarMult(a, new(big.Int).SetBytes(input[64:]))), nil
+}
+
+// ecPairing checks that the product of the BN254 pairings of a list of (G1,
+// G2) pairs is one (EIP-197). Each pair is 192 bytes: the G1 point, then the
+// G2 point as x and y, each an element a·i + b of Fp2 encoded as a then b.
+// The output is 1 if the check passes and 0 otherwise; malformed input fails
+// the call.
+type ecPairing struct{}
+
+func (ecPairing) gas(input []byte) uint64 {
+	return gasEcPairingBase + gasEcPairingPair*uint64(len(input)/192)
+}
+
+func (ecPairing) run(input []byte) ([]byte, error) {
+	if len(input)%192 != 0 {
+		return nil, fmt.Errorf("%w: ecpairing input of %d bytes", ErrPrecompileInput, len(input))
+	}
+	var ps []*curvePoint
+	var qs []*twistPoint
+	for ; len(input) > 0; input = input[192:] {
+		p, err := decodeG1(input[:64])
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeG2(input[64:192])
+		if err != nil {
+			return nil, err
+		}
+		ps, qs = append(ps, p), append(qs, q)
+	}
+	out := make([]byte, 32)
+	if pairingCheck(ps, qs) {
+		out[31] = 1
+	}
+	return out, nil
+}
+
+// pointEvaluation checks a KZG proof that the polynomial committed to by a
+// blob takes the value y at z (EIP-4844). The input is 192 bytes: the blob's
+// versioned hash, z, y, the commitment, and the proof, the last two being
+// compressed BLS12-381 G1 points. The output is the number of field elements
+// in a blob, then the order of the field, as 32-byte words; a bad proof, or
+// malformed input, fails the call.
+type pointEvaluation struct{}
+
+// blobFieldElements is the number of field elements in a blob.
+const blobFieldElements = 4096
+
+func (pointEvaluation) gas(input []byte) uint64 {
+	return gasPointEval
+}
+
+func (pointEvaluation) run(input []byte) ([]byte, error) {
+	if len(input) != 192 {
+		return nil, fmt.Errorf("%w: point evaluation input of %d bytes", ErrPrecompileInput, len(input))
+	}
+	commitment := input[96:144]
+	if hash := kzgToVersionedHash(commitment); string(hash[:]) != string(input[:32]) {
+		return nil, fmt.Errorf("%w: versioned hash does not match the commitment", ErrPrecompileInput)
+	}
+	z, y := new(big.Int).SetBytes(input[32:64]), new(big.Int).SetBytes(input[64:96])
+	if z.Cmp(blsOrder) >= 0 || y.Cmp(blsOrder) >= 0 {
+		return nil, fmt.Errorf("%w: point evaluation value not in the field", ErrPrecompileInput)
+	}
+	c, err := decodeBlsG1(commitment)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := decodeBlsG1(input[144:192])
+	if err != nil {
+		return nil, err
+	}
+	if !verifyKzgProof(c, z, y, proof) {
+		return nil, fmt.Errorf("%w: invalid KZG proof", ErrPrecompileInput)
+	}
+	out := make([]byte, 64)
+	big.NewInt(blobFieldElements).FillBytes(out[:32])
+	blsOrder.FillBytes(out[32:])
+	return out, nil
+}
+
+// kzgToVersionedHash returns the versioned hash of a KZG commitment: its
+// SHA-256 hash, with the first byte replaced by the version, 0x01.
+func kzgToVersionedHash(commitment []byte) [32]byte {
+	hash := sha256.Sum256(commitment)
+	hash[0] = 0x01
+	return hash
+}
+
+// decodeG1 decodes a point of G1 from 64 bytes.
+func decodeG1(b []byte) (*curvePoint, error) {
+	x, y := new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:64])
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, nil
+	}
+	if !bn254G1.isOnCurve(x, y) {
+		return nil, fmt.Errorf("%w: point (%#x, %#x) not on the bn254 curve", ErrPrecompileInput, x, y)
+	}
+	return &curvePoint{x, y}, nil
+}
+
+// encodeG1 encodes a point of G1 in 64 bytes.
+func encodeG1(p *curvePoint) []byte {
+	out := make([]byte, 64)
+	if p != nil {
+		p.x.FillBytes(out[:32])
+		p.y.FillBytes(out[32:])
+	}
+	return out
+}
+
+// decodeG2 decodes a point of G2 from 128 bytes. Unlike G1, the twist has
+// points outside the group, which are rejected too.
+func decodeG2(b []byte) (*twistPoint, error) {
+	var c [4]*big.Int
+	for i := range c {
+		c[i] = new(big.Int).SetBytes(b[32*i : 32*(i+1)])
+		if c[i].Cmp(bn254P) >= 0 {
+			return nil, fmt.Errorf("%w: bn254 G2 coordinate %#x not in the field", ErrPrecompileInput, c[i])
+		}
+	}
+	x, y := fp2{c[1], c[0]}, fp2{c[3], c[2]}
+	if x.isZero() && y.isZero() {
+		return nil, nil
+	}
+	if !isOnTwist(x, y) {
+		return nil, fmt.Errorf("%w: point not on the bn254 twist", ErrPrecompileInput)
+	}
+	q := &twistPoint{x, y}
+	if twistScalarMult(q, bn254Order) != nil {
+		return nil, fmt.Errorf("%w: point not in bn254 G2", ErrPrecompileInput)
+	}
+	return q, nil
+}
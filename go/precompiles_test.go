@@ -0,0 +1,438 @@
+package evm
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestPrecompiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		input   string
+		want    string
+		gas     uint64
+	}{
+		{"ECRECOVER", "0x1", "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e" + "000000000000000000000000000000000000000000000000000000000000001b" + "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e" + "789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02", "000000000000000000000000ceaccac640adf55b2028469bd36ba501f28b699d", 3000},
+		// Signed with private key 1.
+		{"ECRECOVER (key 1)", "0x1", "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef" + "000000000000000000000000000000000000000000000000000000000000001c" + "d90cd625ee87dd38656dd95cf79f65f60f7273b67d3096e68bd81e4f5342691f" + "e9664ae778b1cf6e75f01a148fd6d40be870de25600807d2d65e1d9cc1ec1167", "0000000000000000000000007e5f4552091a69125d5dfcb7b8c2659029395bdf", 3000},
+		{"ECRECOVER (bad v)", "0x1", "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef" + "000000000000000000000000000000000000000000000000000000000000001d" + "d90cd625ee87dd38656dd95cf79f65f60f7273b67d3096e68bd81e4f5342691f" + "e9664ae778b1cf6e75f01a148fd6d40be870de25600807d2d65e1d9cc1ec1167", "", 3000},
+		{"ECRECOVER (zero r)", "0x1", "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef" + "000000000000000000000000000000000000000000000000000000000000001c", "", 3000},
+		{"SHA256 (empty)", "0x2", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", 60},
+		{"SHA256", "0x2", "616263", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", 60 + 12},
+		{"RIPEMD160", "0x3", "616263", "0000000000000000000000008eb208f7e05d987a9b044a8e98c6b087f15a0bfc", 600 + 120},
+		{"IDENTITY", "0x4", strings.Repeat("ab", 33), strings.Repeat("ab", 33), 15 + 2*3},
+		// Fermat's little theorem, from EIP-198.
+		{"MODEXP", "0x5", "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000020" + "0000000000000000000000000000000000000000000000000000000000000020" + "03" + "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" + "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", "0000000000000000000000000000000000000000000000000000000000000001", 16 * 255 / 3},
+		{"MODEXP (zero base)", "0x5", "0000000000000000000000000000000000000000000000000000000000000000" + "0000000000000000000000000000000000000000000000000000000000000020" + "0000000000000000000000000000000000000000000000000000000000000020" + "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" + "fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", "0000000000000000000000000000000000000000000000000000000000000000", 16 * 255 / 3},
+		{"MODEXP (minimum gas)", "0x5", "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000002" + "02" + "03" + "0005", "0003", 200},
+		{"MODEXP (zero modulus)", "0x5", "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000001" + "0000000000000000000000000000000000000000000000000000000000000002" + "02" + "03", "0000", 200},
+		{"MODEXP (empty)", "0x5", "", "", 200},
+		{"ECADD", "0x6", "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002" + "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002", "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd315ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4", 150},
+		{"ECADD (infinity)", "0x6", "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002", "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002", 150},
+		{"ECMUL", "0x7", "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002" + "0000000000000000000000000000000000000000000000000000000000000002", "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd315ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4", 6000},
+		{"ECMUL (by zero)", "0x7", "00000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000002", strings.Repeat("00", 64), 6000},
+		{"ECPAIRING (empty)", "0x8", "", "0000000000000000000000000000000000000000000000000000000000000001", 45000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := precompiles[HexToAddress(tt.address)]
+			input, _ := hex.DecodeString(tt.input)
+			if got := p.gas(input); got != tt.gas {
+				t.Errorf("gas = %d; want %d", got, tt.gas)
+			}
+			out, err := p.run(input)
+			if err != nil {
+				t.Fatalf("run(%s) error %v", tt.input, err)
+			}
+			if got := hex.EncodeToString(out); got != tt.want {
+				t.Errorf("run(%s) = %s; want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModExpLargeExponent(t *testing.T) {
+	// 3^2 mod 7, with the exponent padded to 5,000,000 bytes, which costs
+	// well under the default gas limit.
+	const expLen = 5_000_000
+	input := make([]byte, 96+1+expLen+1)
+	input[31], input[95] = 1, 1 // base and mod lengths
+	new(big.Int).SetUint64(expLen).FillBytes(input[32:64])
+	input[96], input[96+expLen], input[96+1+expLen] = 3, 2, 7
+
+	p := precompiles[HexToAddress("0x5")]
+	if got, want := p.gas(input), uint64((expLen-32)*8/3); got != want {
+		t.Errorf("gas = %d; want %d", got, want)
+	}
+	out, err := p.run(input)
+	if err != nil {
+		t.Fatalf("run error %v", err)
+	}
+	if len(out) != 1 || out[0] != 2 {
+		t.Errorf("run = %x; want 02", out)
+	}
+}
+
+func TestEvmCallPrecompile(t *testing.T) {
+	// MSTORE(0, "abc"), STATICCALL(1000, 0x2, 29, 3, 0, 32), MLOAD(0)
+	bin, _ := hex.DecodeString("62616263600052" + "602060006003601d" + "60026103e8fa" + "600051")
+	res := Evm(bin, Transaction{To: "0xcc", Gas: "0x186a0"}, BlockContext{}, nil)
+	if res.Failed() {
+		t.Fatalf("Evm(STATICCALL 0x2).Err = %v", res.Err)
+	}
+	if got, want := res.Stack[0].Hex(), "0xba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("SHA256(\"abc\") = %s; want %s", got, want)
+	}
+	if got := res.Stack[1].Uint64(); got != 1 {
+		t.Errorf("STATICCALL = %d; want 1", got)
+	}
+	// The precompile is warm, and charges 72 gas for one word.
+	if want := uint64(3 + 3 + 3 + 3 + 6*3 + 100 + 72 + 3 + 3); res.GasUsed != want {
+		t.Errorf("GasUsed = %d; want %d", res.GasUsed, want)
+	}
+}
+
+// bn254G2Gen is the generator of G2.
+var bn254G2Gen = &twistPoint{
+	x: fp2{mustParseBig("1800deef121f1e76426a00665e5c4479674322d4f75edadd46debd5cd992f6ed"), mustParseBig("198e9393920d483a7260bfb731fb5d25f1aa493335a9e71297e485b7aef312c2")},
+	y: fp2{mustParseBig("12c85ea5db8c6deb4aab71808dcb408fe3d1e7690c43d37b4ce6cc0166fa7daa"), mustParseBig("090689d0585ff075ec9e99ad690c3395bc4b313370b38ef355acdadcd122975b")},
+}
+
+// pairingInput encodes the pairs (ps[i], qs[i]) as ECPAIRING input.
+func pairingInput(ps []*curvePoint, qs []*twistPoint) []byte {
+	var input []byte
+	for i := range ps {
+		input = append(input, encodeG1(ps[i])...)
+		for _, c := range []*big.Int{qs[i].x.b, qs[i].x.a, qs[i].y.b, qs[i].y.a} {
+			input = append(input, c.FillBytes(make([]byte, 32))...)
+		}
+	}
+	return input
+}
+
+func TestEcPairing(t *testing.T) {
+	g1 := &curvePoint{big.NewInt(1), big.NewInt(2)}
+	negG1 := &curvePoint{big.NewInt(1), new(big.Int).Sub(bn254P, big.NewInt(2))}
+	a, b := big.NewInt(6), big.NewInt(35)
+	tests := []struct {
+		name string
+		ps   []*curvePoint
+		qs   []*twistPoint
+		want bool
+	}{
+		{"e(P, Q)", []*curvePoint{g1}, []*twistPoint{bn254G2Gen}, false},
+		{"e(P, Q)·e(-P, Q)", []*curvePoint{g1, negG1}, []*twistPoint{bn254G2Gen, bn254G2Gen}, true},
+		// e(aP, bQ) = e(abP, Q), by bilinearity.
+		{"e(aP, bQ)·e(-abP, Q)",
+			[]*curvePoint{bn254G1.scalarMult(g1, a), bn254G1.scalarMult(negG1, new(big.Int).Mul(a, b))},
+			[]*twistPoint{twistScalarMult(bn254G2Gen, b), bn254G2Gen}, true},
+		{"e(aP, bQ)·e(-aP, Q)",
+			[]*curvePoint{bn254G1.scalarMult(g1, a), bn254G1.scalarMult(negG1, a)},
+			[]*twistPoint{twistScalarMult(bn254G2Gen, b), bn254G2Gen}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := pairingInput(tt.ps, tt.qs)
+			if got, want := (ecPairing{}).gas(input), 45000+34000*uint64(len(tt.ps)); got != want {
+				t.Errorf("gas = %d; want %d", got, want)
+			}
+			out, err := ecPairing{}.run(input)
+			if err != nil {
+				t.Fatalf("run error %v", err)
+			}
+			if got := out[31] == 1; got != tt.want {
+				t.Errorf("pairing check = %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrecompileInvalidInput(t *testing.T) {
+	offCurve := strings.Repeat("00", 31) + "01" + strings.Repeat("00", 31) + "01"
+	g2 := hex.EncodeToString(pairingInput([]*curvePoint{nil}, []*twistPoint{bn254G2Gen})[64:])
+	tests := []struct {
+		name    string
+		address string
+		input   string
+	}{
+		{"ECADD (not on curve)", "0x6", offCurve},
+		{"ECMUL (not on curve)", "0x7", offCurve},
+		{"ECPAIRING (bad length)", "0x8", strings.Repeat("00", 191)},
+		{"ECPAIRING (G1 not on curve)", "0x8", offCurve + g2},
+		{"ECPAIRING (G2 not on twist)", "0x8", strings.Repeat("00", 64) + strings.Repeat("00", 127) + "01"},
+		// (1, 1) in the high limbs is out of the field.
+		{"ECPAIRING (G2 not in field)", "0x8", strings.Repeat("00", 64) + strings.Repeat("ff", 32) + g2[64:]},
+		{"MODEXP (huge modulus)", "0x5", strings.Repeat("00", 32) + strings.Repeat("00", 32) + strings.Repeat("ff", 32)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := hex.DecodeString(tt.input)
+			if _, err := precompiles[HexToAddress(tt.address)].run(input); !errors.Is(err, ErrPrecompileInput) {
+				t.Errorf("run error %v; want ErrPrecompileInput", err)
+			}
+		})
+	}
+	// A point on the twist outside G2 fails too.
+	x := fp2One()
+	y, ok := fp2Sqrt(x.mul(x).mul(x).add(twistB))
+	for !ok {
+		x = x.add(fp2One())
+		y, ok = fp2Sqrt(x.mul(x).mul(x).add(twistB))
+	}
+	if _, err := decodeG2(pairingInput([]*curvePoint{nil}, []*twistPoint{{x, y}})[64:]); !errors.Is(err, ErrPrecompileInput) {
+		t.Errorf("decodeG2(point outside G2) error %v; want ErrPrecompileInput", err)
+	}
+}
+
+// fp2Sqrt returns a square root of a, if it has one. As p = 3 mod 4, it is
+// a^((p+1)/4)·c for c = 1, i or a square root of a^((p-1)/2).
+func fp2Sqrt(a fp2) (fp2, bool) {
+	a1 := a.exp(new(big.Int).Rsh(new(big.Int).Sub(bn254P, big.NewInt(3)), 2))
+	alpha := a1.mul(a1).mul(a)
+	x := a1.mul(a)
+	if alpha.equal(fp2One().neg()) {
+		x = x.mul(fp2{new(big.Int), big.NewInt(1)})
+	} else {
+		x = x.mul(alpha.add(fp2One()).exp(new(big.Int).Rsh(bn254P, 1)))
+	}
+	return x, x.mul(x).equal(a)
+}
+
+// echoPrecompile returns its input, or reverts if the input is "revert", and
+// records the calls made to it.
+type echoPrecompile struct {
+	calls []PrecompileCall
+}
+
+func (e *echoPrecompile) Gas(input []byte) uint64 {
+	return 100 + uint64(len(input))
+}
+
+func (e *echoPrecompile) Run(call PrecompileCall) ([]byte, error) {
+	e.calls = append(e.calls, call)
+	if string(call.Input) == "revert" {
+		return []byte("no"), ErrExecutionReverted
+	}
+	return call.Input, nil
+}
+
+var echoAddress = HexToAddress("0xfe01")
+
+func TestInterpreterPrecompiles(t *testing.T) {
+	echo := &echoPrecompile{}
+	in := &Interpreter{Precompiles: map[Address]Precompile{echoAddress: echo}}
+	sender, contract := HexToAddress("0xaa"), HexToAddress("0xcc")
+	state := mustState(t, Accounts{sender.Hex(): {Balance: "0x10"}})
+
+	// MSTORE8(0, 0x2a), then pass the byte to 0xfe01 with CALL sending 5 wei,
+	// STATICCALL and DELEGATECALL, copying each output to its own word.
+	bin, _ := hex.DecodeString("602a600053" +
+		"6001600060016000600561fe0161fffff1" +
+		"6001602060016000" + "61fe0161fffffa" +
+		"6001604060016000" + "61fe0161fffff4" +
+		"600051" + "602051" + "604051")
+	res := in.Run(bin, Transaction{From: sender.Hex(), To: contract.Hex(), Value: "0x7"}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Run(CALL 0xfe01).Err = %v", res.Err)
+	}
+	for i, w := range res.Stack {
+		if want := uint64(1); i >= 3 && w.Uint64() != want {
+			t.Errorf("call %d = %d; want %d", 6-i, w.Uint64(), want)
+		} else if i < 3 && w.Bytes32()[0] != 0x2a {
+			t.Errorf("output %d = %s; want 0x2a...", 3-i, w.Hex())
+		}
+	}
+	want := []PrecompileCall{
+		{Input: []byte{0x2a}, Caller: contract, Value: *NewWord(5)},
+		{Input: []byte{0x2a}, Caller: contract, ReadOnly: true},
+		// DELEGATECALL keeps the caller and value of the transaction.
+		{Input: []byte{0x2a}, Caller: sender, Value: *NewWord(7)},
+	}
+	if len(echo.calls) != len(want) {
+		t.Fatalf("echo called %d times; want %d", len(echo.calls), len(want))
+	}
+	for i, got := range echo.calls {
+		if string(got.Input) != string(want[i].Input) || got.Caller != want[i].Caller || !got.Value.Eq(&want[i].Value) || got.ReadOnly != want[i].ReadOnly {
+			t.Errorf("call %d = %+v; want %+v", i+1, got, want[i])
+		}
+	}
+	if got := state.GetBalance(echoAddress); got.Uint64() != 5 {
+		t.Errorf("balance of %s = %s; want 0x5", echoAddress, got.Hex())
+	}
+}
+
+func TestInterpreterPrecompilesRevert(t *testing.T) {
+	in := &Interpreter{Precompiles: map[Address]Precompile{echoAddress: &echoPrecompile{}}}
+	// MSTORE("revert"), CALL(0xffff, 0xfe01, 0, 26, 6, 0, 0), RETURNDATASIZE
+	bin, _ := hex.DecodeString("65726576657274600052" + "600060006006601a600061fe0161fffff1" + "3d")
+	res := in.Run(bin, Transaction{To: "0xcc", Gas: "0x186a0"}, BlockContext{}, nil)
+	if res.Failed() {
+		t.Fatalf("Run(CALL 0xfe01).Err = %v", res.Err)
+	}
+	if got := res.Stack[1].Uint64(); got != 0 {
+		t.Errorf("CALL = %d; want 0", got)
+	}
+	if got := res.Stack[0].Uint64(); got != 2 {
+		t.Errorf("RETURNDATASIZE = %d; want 2", got)
+	}
+	// A revert returns the gas the call was given.
+	if res.GasUsed > 0xffff {
+		t.Errorf("GasUsed = %d; want the unused call gas returned", res.GasUsed)
+	}
+}
+
+func TestInterpreterPrecompilesScope(t *testing.T) {
+	// MSTORE("revert"), CALL(0xffff, address, 0, 26, 6, 0, 0), RETURNDATASIZE
+	call := func(address string) []byte {
+		bin, _ := hex.DecodeString("65726576657274600052" + "600060006006601a6000" + address + "61fffff1" + "3d")
+		return bin
+	}
+	echo := map[Address]Precompile{echoAddress: &echoPrecompile{}, HexToAddress("0x4"): &echoPrecompile{}}
+	tests := []struct {
+		name        string
+		precompiles map[Address]Precompile
+		address     string
+		want        uint64 // RETURNDATASIZE
+	}{
+		// Without it, 0xfe01 is an empty account, and 0x4 is IDENTITY.
+		{"custom", echo, "61fe01", 2},
+		{"custom elsewhere", nil, "61fe01", 0},
+		{"replacing IDENTITY", echo, "6004", 2},
+		{"IDENTITY", nil, "6004", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &Interpreter{Precompiles: tt.precompiles}
+			res := in.Run(call(tt.address), Transaction{To: "0xcc", Gas: "0x186a0"}, BlockContext{}, nil)
+			if res.Failed() {
+				t.Fatalf("Run(CALL).Err = %v", res.Err)
+			}
+			if got := res.Stack[0].Uint64(); got != tt.want {
+				t.Errorf("RETURNDATASIZE = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// pointEvaluationInput encodes a KZG proof, with the versioned hash of its
+// commitment, as point evaluation input.
+func pointEvaluationInput(commitment, z, y, proof string) []byte {
+	input, _ := hex.DecodeString(z + y + commitment + proof)
+	hash := kzgToVersionedHash(input[64:112])
+	return append(hash[:], input...)
+}
+
+func TestPointEvaluation(t *testing.T) {
+	const (
+		infinity = "c0" + "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+		g1       = "97f1d3a73197d7942695638c4fa9ac0fc3688c4f9774b905a14e3a3f171bac586c55e83ff97a1aeffb3af00adb22c6bb"
+		zero     = "0000000000000000000000000000000000000000000000000000000000000000"
+		two      = "0000000000000000000000000000000000000000000000000000000000000002"
+		// rMinus1 is the order of the BLS12-381 scalar field, less one.
+		rMinus1 = "73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000000"
+	)
+	// From the verify_kzg_proof tests of the consensus specs.
+	tests := []struct {
+		name                    string
+		commitment, z, y, proof string
+		want                    bool
+	}{
+		{"zero polynomial", infinity, two, zero, infinity, true},
+		{"constant polynomial", "a572cbea904d67468808c8eb50a9450c9721db309128012543902d0ac358a62ae28f75bb8f1c7c42c39a8c5529bf0f4e", zero, two, infinity, true},
+		{"correct proof", "93efc82d2017e9c57834a1246463e64774e56183bb247c8fc9dd98c56817e878d97b05f5c8d900acf1fbbbca6f146556", rMinus1, zero, "92c51ff81dd71dab71cefecd79e8274b4b7ba36a0f40e2dc086bc4061c7f63249877db23297212991fd63e07b7ebc348", true},
+		{"correct proof, y ≠ 0", "93efc82d2017e9c57834a1246463e64774e56183bb247c8fc9dd98c56817e878d97b05f5c8d900acf1fbbbca6f146556", zero, "73e66878b46ae3705eb6a46a89213de7d3686828bfce5c19400fffff00100001", "b82ded761997f2c6f1bb3db1e1dada2ef06d936551667c82f659b75f99d2da2068b81340823ee4e829a93c9fbed7810d", true},
+		{"incorrect proof", infinity, two, zero, g1, false},
+		{"incorrect proof at infinity", "a421e229565952cfff4ef3517100a97da1d4fe57956fa50a442f92af03b1bf37adacc8ad4ed209b31287ea5bb94d9d06", rMinus1, "304962b3598a0adf33189fdfd9789feab1096ff40006900400000003fffffffc", infinity, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := pointEvaluationInput(tt.commitment, tt.z, tt.y, tt.proof)
+			if got := (pointEvaluation{}).gas(input); got != 50000 {
+				t.Errorf("gas = %d; want 50000", got)
+			}
+			out, err := pointEvaluation{}.run(input)
+			if !tt.want {
+				if !errors.Is(err, ErrPrecompileInput) {
+					t.Errorf("run error %v; want ErrPrecompileInput", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run error %v", err)
+			}
+			if got, want := hex.EncodeToString(out), "0000000000000000000000000000000000000000000000000000000000001000"+"73eda753299d7d483339d80809a1d80553bda402fffe5bfeffffffff00000001"; got != want {
+				t.Errorf("run = %s; want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestPointEvaluationInvalidInput(t *testing.T) {
+	const (
+		commitment = "a572cbea904d67468808c8eb50a9450c9721db309128012543902d0ac358a62ae28f75bb8f1c7c42c39a8c5529bf0f4e"
+		infinity   = "c0" + "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+		zero       = "0000000000000000000000000000000000000000000000000000000000000000"
+		two        = "0000000000000000000000000000000000000000000000000000000000000002"
+		max        = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+		// x = 1 has no y on the curve.
+		notOnCurve = "80" + "00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000" + "01"
+		// x = 0 is on the curve, but the point is outside G1.
+		notInG1 = "80" + "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+	)
+	valid := pointEvaluationInput(commitment, zero, two, infinity)
+	badHash := append([]byte{0x02}, valid[1:]...)
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"short", valid[:191]},
+		{"long", append(valid, 0)},
+		{"versioned hash", badHash},
+		{"z not in field", pointEvaluationInput(commitment, max, two, infinity)},
+		{"y not in field", pointEvaluationInput(commitment, zero, max, infinity)},
+		{"commitment not on curve", pointEvaluationInput(notOnCurve, zero, two, infinity)},
+		{"commitment not in G1", pointEvaluationInput(notInG1, zero, two, infinity)},
+		{"proof not on curve", pointEvaluationInput(commitment, zero, two, notOnCurve)},
+		{"uncompressed proof", pointEvaluationInput(commitment, zero, two, "00"+infinity[2:])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (pointEvaluation{}).run(tt.input); !errors.Is(err, ErrPrecompileInput) {
+				t.Errorf("run error %v; want ErrPrecompileInput", err)
+			}
+		})
+	}
+}
+
+func TestPointEvaluationFork(t *testing.T) {
+	pointEvaluationAddress := HexToAddress("0xa")
+	// STATICCALL(0xffff, 0xa, 0, 0, 0, 0): the empty input fails the call.
+	bin, _ := hex.DecodeString("6000600060006000600a61fffffa")
+	tests := []struct {
+		fork Fork
+		want uint64 // STATICCALL
+	}{
+		// Before Cancun, 0xa is an empty account.
+		{Shanghai, 1},
+		{Cancun, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fork.String(), func(t *testing.T) {
+			_, active := activePrecompiles(tt.fork, nil)[pointEvaluationAddress]
+			if want := tt.fork >= Cancun; active != want {
+				t.Errorf("0xa active = %t; want %t", active, want)
+			}
+			res := (&Interpreter{Fork: tt.fork}).Run(bin, Transaction{To: "0xcc", Gas: "0x186a0"}, BlockContext{}, nil)
+			if res.Failed() {
+				t.Fatalf("Run(STATICCALL 0xa).Err = %v", res.Err)
+			}
+			if got := res.Stack[0].Uint64(); got != tt.want {
+				t.Errorf("STATICCALL = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
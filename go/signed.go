@@ -0,0 +1,87 @@
+package evm
+
+// Signed arithmetic on Words. The EVM has no separate signed type: SDIV, SMOD,
+// SLT, SGT, SAR and SIGNEXTEND reinterpret their 256-bit operands as two's
+// complement integers in the range [-2^255, 2^255-1].
+
+// minInt256 is -2^255, the most negative signed Word.
+var minInt256 = Word{0, 0, 0, 1 << 63}
+
+// SDiv sets z to x / y interpreted as signed integers, truncated toward zero,
+// or to 0 if y is 0. The one overflowing case, -2^255 / -1, yields -2^255.
+func (z *Word) SDiv(x, y *Word) *Word {
+	if y.IsZero() {
+		return z.Clear()
+	}
+	var minusOne Word
+	minusOne.Not(&minusOne)
+	if x.Eq(&minInt256) && y.Eq(&minusOne) {
+		return z.Set(&minInt256)
+	}
+	negative := x.Sign() != y.Sign()
+	var a, b Word
+	z.Div(a.Abs(x), b.Abs(y))
+	if negative {
+		z.Neg(z)
+	}
+	return z
+}
+
+// SMod sets z to x % y interpreted as signed integers, or to 0 if y is 0. The
+// result takes the sign of the dividend x.
+func (z *Word) SMod(x, y *Word) *Word {
+	if y.IsZero() {
+		return z.Clear()
+	}
+	negative := x.Sign() < 0
+	var a, b Word
+	z.Mod(a.Abs(x), b.Abs(y))
+	if negative {
+		z.Neg(z)
+	}
+	return z
+}
+
+// Slt reports whether z < x interpreted as signed integers.
+func (z *Word) Slt(x *Word) bool {
+	zNeg, xNeg := z.Sign() < 0, x.Sign() < 0
+	if zNeg != xNeg {
+		return zNeg
+	}
+	// Two's complement preserves ordering between values of the same sign.
+	return z.Lt(x)
+}
+
+// Sgt reports whether z > x interpreted as signed integers.
+func (z *Word) Sgt(x *Word) bool {
+	return x.Slt(z)
+}
+
+// Sar sets z to x >> n, filling the vacated bits with the sign bit of x.
+func (z *Word) Sar(x *Word, n uint) *Word {
+	if x.Sign() >= 0 {
+		return z.Rsh(x, n)
+	}
+	if n >= 256 {
+		return z.Not(z.Clear())
+	}
+	var fill Word
+	fill.Not(&fill).Lsh(&fill, 256-n)
+	z.Rsh(x, n)
+	return z.Or(z, &fill)
+}
+
+// SignExtend sets z to x sign-extended from its (b+1)-th least significant
+// byte, as SIGNEXTEND does. If b is 31 or more, x is returned unchanged.
+func (z *Word) SignExtend(b, x *Word) *Word {
+	if !b.IsUint64() || b.Uint64() >= 31 {
+		return z.Set(x)
+	}
+	bit := uint(b.Uint64()*8 + 7)
+	var mask Word
+	mask.Lsh(NewWord(1), bit+1).Sub(&mask, NewWord(1))
+	if x[bit/64]>>(bit%64)&1 == 1 {
+		return z.Or(x, mask.Not(&mask))
+	}
+	return z.And(x, &mask)
+}
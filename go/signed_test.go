@@ -0,0 +1,97 @@
+package evm
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+// toSigned interprets w as a two's complement signed integer.
+func toSigned(w *Word) *big.Int {
+	v := w.ToBig()
+	if w.Sign() < 0 {
+		v.Sub(v, twoTo256)
+	}
+	return v
+}
+
+func TestSignedArithmetic(t *testing.T) {
+	minusOne := new(Word).Not(&Word{})
+	fixed := []Word{{}, *NewWord(1), *NewWord(0x80), *minusOne, minInt256, *new(Word).Not(&minInt256)}
+
+	r := rand.New(rand.NewSource(1))
+	operands := func() (Word, Word) {
+		pick := func() Word {
+			if r.Intn(3) == 0 {
+				return fixed[r.Intn(len(fixed))]
+			}
+			w := randWord(r)
+			if r.Intn(2) == 0 {
+				w.Neg(&w)
+			}
+			return w
+		}
+		return pick(), pick()
+	}
+
+	for i := 0; i < 5000; i++ {
+		x, y := operands()
+		bx, by := toSigned(&x), toSigned(&y)
+
+		wantDiv, wantMod := new(big.Int), new(big.Int)
+		if by.Sign() != 0 {
+			// big.Int.Quo and Rem truncate toward zero, as SDIV and SMOD do.
+			wantDiv.Quo(bx, by)
+			wantMod.Rem(bx, by)
+		}
+		var gotDiv, gotMod Word
+		if gotDiv.SDiv(&x, &y); gotDiv != *new(Word).SetFromBig(wantDiv) {
+			t.Fatalf("SDiv(%s, %s) = %s; want %d", x.Hex(), y.Hex(), gotDiv.Hex(), wantDiv)
+		}
+		if gotMod.SMod(&x, &y); gotMod != *new(Word).SetFromBig(wantMod) {
+			t.Fatalf("SMod(%s, %s) = %s; want %d", x.Hex(), y.Hex(), gotMod.Hex(), wantMod)
+		}
+		if got, want := x.Slt(&y), bx.Cmp(by) < 0; got != want {
+			t.Fatalf("Slt(%s, %s) = %t; want %t", x.Hex(), y.Hex(), got, want)
+		}
+		if got, want := x.Sgt(&y), bx.Cmp(by) > 0; got != want {
+			t.Fatalf("Sgt(%s, %s) = %t; want %t", x.Hex(), y.Hex(), got, want)
+		}
+
+		n := uint(y[0] % 260)
+		// big.Int.Rsh rounds toward negative infinity, matching SAR.
+		wantSar := new(big.Int).Rsh(bx, n)
+		if got := new(Word).Sar(&x, n); *got != *new(Word).SetFromBig(wantSar) {
+			t.Fatalf("Sar(%s, %d) = %s; want %d", x.Hex(), n, got.Hex(), wantSar)
+		}
+	}
+}
+
+func TestSDivOverflow(t *testing.T) {
+	minusOne := new(Word).Not(&Word{})
+	if got := new(Word).SDiv(&minInt256, minusOne); !got.Eq(&minInt256) {
+		t.Errorf("SDiv(MIN_INT, -1) = %s; want %s", got.Hex(), minInt256.Hex())
+	}
+}
+
+func TestSignExtend(t *testing.T) {
+	tests := []struct {
+		b, x, want string
+	}{
+		{"0x0", "0xff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"0x0", "0x7f", "0x7f"},
+		{"0x0", "0x1ff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"0x0", "0x17f", "0x7f"},
+		{"0x1", "0x8000", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff8000"},
+		{"0x7", "0xff0000000000000000", "0x0"},
+		{"0x1e", "0x80" + "000000000000000000000000000000000000000000000000000000000000", "0xff80" + "000000000000000000000000000000000000000000000000000000000000"},
+		{"0x1f", "0x8000", "0x8000"},
+		{"0x100", "0xff", "0xff"},
+	}
+	for _, tt := range tests {
+		b, x := hexToWord(tt.b), hexToWord(tt.x)
+		if got := new(Word).SignExtend(b, x); got.Hex() != tt.want {
+			t.Errorf("SignExtend(%s, %s) = %s; want %s", tt.b, tt.x, got.Hex(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package evm
+
+import "fmt"
+
+// stackLimit is the maximum number of items on the EVM stack.
+const stackLimit = 1024
+
+// Stack is the EVM operand stack. Items are stored bottom first, so pushes and
+// pops only touch the end of the underlying slice.
+//
+// Push, Pop and the other accessors do not check bounds themselves; callers
+// check an opcode's requirements with Require before running it.
+type Stack struct {
+	data []Word
+}
+
+// NewStack returns an empty stack.
+func NewStack() *Stack {
+	return &Stack{data: make([]Word, 0, 16)}
+}
+
+// Len returns the number of items on the stack.
+func (st *Stack) Len() int {
+	return len(st.data)
+}
+
+// Require returns ErrStackUnderflow if the stack holds fewer than pops items,
+// or ErrStackOverflow if popping pops items and then pushing pushes items
+// would exceed the stack limit.
+func (st *Stack) Require(pops, pushes int) error {
+	if len(st.data) < pops {
+		return fmt.Errorf("%w: have %d, want %d", ErrStackUnderflow, len(st.data), pops)
+	}
+	if len(st.data)-pops+pushes > stackLimit {
+		return fmt.Errorf("%w: have %d, limit %d", ErrStackOverflow, len(st.data)-pops+pushes, stackLimit)
+	}
+	return nil
+}
+
+// Push pushes a copy of w onto the stack.
+func (st *Stack) Push(w *Word) {
+	st.data = append(st.data, *w)
+}
+
+// Pop removes and returns the top item.
+func (st *Stack) Pop() Word {
+	w := st.data[len(st.data)-1]
+	st.data = st.data[:len(st.data)-1]
+	return w
+}
+
+// Peek returns a pointer to the top item, so it can be replaced in place.
+func (st *Stack) Peek() *Word {
+	return &st.data[len(st.data)-1]
+}
+
+// Back returns a pointer to the n-th item below the top; Back(0) is the top.
+func (st *Stack) Back(n int) *Word {
+	return &st.data[len(st.data)-1-n]
+}
+
+// Dup pushes a copy of the n-th item, counting the top as 1, as DUPn does.
+func (st *Stack) Dup(n int) {
+	st.data = append(st.data, st.data[len(st.data)-n])
+}
+
+// Swap exchanges the top item with the one n places below it, as SWAPn does.
+func (st *Stack) Swap(n int) {
+	top := len(st.data) - 1
+	st.data[top], st.data[top-n] = st.data[top-n], st.data[top]
+}
+
+// items returns a copy of the stack contents, top first.
+func (st *Stack) items() []Word {
+	items := make([]Word, len(st.data))
+	for i := range st.data {
+		items[i] = st.data[len(st.data)-1-i]
+	}
+	return items
+}
@@ -0,0 +1,65 @@
+package evm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStackDupSwap(t *testing.T) {
+	st := NewStack()
+	for i := uint64(1); i <= 4; i++ {
+		st.Push(NewWord(i))
+	}
+	st.Dup(3)  // bottom first: 1 2 3 4 2
+	st.Swap(4) // bottom first: 2 2 3 4 1
+	want := []uint64{1, 4, 3, 2, 2}
+	got := st.items()
+	if len(got) != len(want) {
+		t.Fatalf("items() has %d entries; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != *NewWord(want[i]) {
+			t.Errorf("items()[%d] = %s; want %#x", i, got[i].Hex(), want[i])
+		}
+	}
+}
+
+func TestStackRequire(t *testing.T) {
+	st := NewStack()
+	if err := st.Require(1, 0); !errors.Is(err, ErrStackUnderflow) {
+		t.Errorf("Require(1, 0) on empty stack = %v; want %v", err, ErrStackUnderflow)
+	}
+	for i := 0; i < stackLimit; i++ {
+		st.Push(new(Word))
+	}
+	if err := st.Require(0, 1); !errors.Is(err, ErrStackOverflow) {
+		t.Errorf("Require(0, 1) on full stack = %v; want %v", err, ErrStackOverflow)
+	}
+	if err := st.Require(2, 1); err != nil {
+		t.Errorf("Require(2, 1) on full stack = %v; want nil", err)
+	}
+}
+
+func TestEvmStackLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		want error
+	}{
+		{"DUP1 (empty)", []byte{0x80}, ErrStackUnderflow},
+		{"SWAP1 (one item)", []byte{0x5f, 0x90}, ErrStackUnderflow},
+		{"ISZERO (empty)", []byte{0x15}, ErrStackUnderflow},
+		{"CALL (underflow)", []byte{0x5f, 0x5f, 0xf1}, ErrStackUnderflow},
+		{"PUSH0 x1025", bytes.Repeat([]byte{0x5f}, stackLimit+1), ErrStackOverflow},
+		{"PUSH0 x1024", bytes.Repeat([]byte{0x5f}, stackLimit), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Evm(tt.code, Transaction{}, BlockContext{}, nil)
+			if !errors.Is(res.Err, tt.want) {
+				t.Errorf("Evm(…).Err = %v; want %v", res.Err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package evm
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Address is a 20-byte account address.
+type Address [20]byte
+
+// HexToAddress parses a hex address, with or without the "0x" prefix. Leading
+// zeros may be omitted; invalid input yields the zero address.
+func HexToAddress(s string) Address {
+	return wordToAddress(hexToWord(s))
+}
+
+// wordToAddress returns the address held in the low 20 bytes of w, as opcodes
+// taking an address operand interpret it.
+func wordToAddress(w *Word) Address {
+	var a Address
+	b := w.Bytes32()
+	copy(a[:], b[12:])
+	return a
+}
+
+// Word returns a as a stack word.
+func (a Address) Word() *Word {
+	return new(Word).SetBytes(a[:])
+}
+
+// Hex returns a as a "0x"-prefixed string of 40 lowercase hex digits.
+func (a Address) Hex() string {
+	return "0x" + hex.EncodeToString(a[:])
+}
+
+// String implements fmt.Stringer and returns a in hex.
+func (a Address) String() string {
+	return a.Hex()
+}
+
+// MarshalText implements encoding.TextMarshaler, so that Addresses can be used
+// as JSON map keys.
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.Hex()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Address) UnmarshalText(text []byte) error {
+	var w Word
+	if err := w.UnmarshalText(text); err != nil || w.BitLen() > 160 {
+		return fmt.Errorf("invalid address %q", text)
+	}
+	*a = wordToAddress(&w)
+	return nil
+}
+
+// StateDB is the world state the interpreter runs against: the accounts, their
+// balances, nonces, code and storage. Reading an account that does not exist
+// returns zero values.
+type StateDB interface {
+	// CreateAccount creates a new account at addr, with no code or storage.
+	// The balance of an existing account at addr is kept.
+	CreateAccount(addr Address)
+	// Exist reports whether an account exists at addr.
+	Exist(addr Address) bool
+	// Empty reports whether the account at addr has no balance, nonce or
+	// code, or does not exist (EIP-161).
+	Empty(addr Address) bool
+
+	GetBalance(addr Address) Word
+	AddBalance(addr Address, amount *Word)
+	SubBalance(addr Address, amount *Word)
+
+	GetNonce(addr Address) uint64
+	SetNonce(addr Address, nonce uint64)
+
+	GetCode(addr Address) []byte
+	GetCodeSize(addr Address) int
+	// GetCodeHash returns the Keccak-256 hash of the code at addr, or zero if
+	// no account exists at addr.
+	GetCodeHash(addr Address) Word
+	SetCode(addr Address, code []byte)
+
+	GetState(addr Address, key Word) Word
+	SetState(addr Address, key, value Word)
+
+	// SelfDestruct deletes the account at addr. The interpreter calls it at
+	// the end of a transaction, for the contracts that self-destructed.
+	SelfDestruct(addr Address)
+
+	// AddLog records a log emitted by a contract.
+	AddLog(log Log)
+	// Logs returns the logs recorded in the current transaction.
+	Logs() []Log
+
+	// Snapshot returns an identifier for the current state. RevertToSnapshot
+	// undoes every change made since the snapshot was taken, logs included,
+	// and invalidates any snapshot taken after it.
+	Snapshot() int
+	RevertToSnapshot(id int)
+
+	// Finalise ends the current transaction: its changes can no longer be
+	// reverted, and its logs are discarded. The interpreter calls it at the
+	// end of every transaction it runs.
+	Finalise()
+}
+
+// canTransfer reports whether the account at from holds at least amount.
+func canTransfer(db StateDB, from Address, amount *Word) bool {
+	balance := db.GetBalance(from)
+	return !balance.Lt(amount)
+}
+
+// transfer moves amount from one account to another. The caller checks the
+// balance with canTransfer first. Transferring nothing leaves both accounts
+// untouched, so that it does not create an empty account at to.
+func transfer(db StateDB, from, to Address, amount *Word) {
+	if amount.IsZero() {
+		return
+	}
+	db.SubBalance(from, amount)
+	db.AddBalance(to, amount)
+}
+
+// stateAccount is an account held by MemStateDB.
+type stateAccount struct {
+	balance  Word
+	nonce    uint64
+	code     []byte
+	codeHash Word
+	storage  Store
+}
+
+// MemStateDB is a StateDB held in memory. Every change is journaled, so that
+// it can be reverted to a snapshot.
+type MemStateDB struct {
+	accounts map[Address]*stateAccount
+	logs     []Log
+	journal  journal
+}
+
+var _ StateDB = (*MemStateDB)(nil)
+
+// emptyCodeHash is the Keccak-256 hash of empty code.
+var emptyCodeHash = keccak256Word(nil)
+
+func keccak256Word(data []byte) Word {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(data)
+	var w Word
+	w.SetBytes(hash.Sum(nil))
+	return w
+}
+
+// NewMemStateDB returns a MemStateDB holding accounts, which may be nil.
+func NewMemStateDB(accounts Accounts) (*MemStateDB, error) {
+	db := &MemStateDB{accounts: make(map[Address]*stateAccount)}
+	for key, account := range accounts {
+		var addr Address
+		if err := addr.UnmarshalText([]byte(key)); err != nil {
+			return nil, err
+		}
+		code, err := hex.DecodeString(account.UserCode.Bin)
+		if err != nil {
+			return nil, fmt.Errorf("code of %s: %w", key, err)
+		}
+		obj := db.getOrCreate(addr)
+		obj.balance = *hexToWord(account.Balance)
+		obj.nonce = hexToWord(account.Nonce).Uint64()
+		obj.code, obj.codeHash = code, keccak256Word(code)
+		for slot, value := range account.Storage {
+			if !value.IsZero() {
+				obj.storage[slot] = value
+			}
+		}
+	}
+	db.Finalise()
+	return db, nil
+}
+
+// Accounts returns the contents of db in the form NewMemStateDB accepts.
+func (db *MemStateDB) Accounts() Accounts {
+	accounts := make(Accounts, len(db.accounts))
+	for addr, obj := range db.accounts {
+		account := Account{
+			Balance:  obj.balance.Hex(),
+			UserCode: usercode{Bin: hex.EncodeToString(obj.code)},
+		}
+		if obj.nonce != 0 {
+			account.Nonce = NewWord(obj.nonce).Hex()
+		}
+		if len(obj.storage) > 0 {
+			account.Storage = make(Store, len(obj.storage))
+			for slot, value := range obj.storage {
+				account.Storage[slot] = value
+			}
+		}
+		accounts[addr.Hex()] = account
+	}
+	return accounts
+}
+
+func (db *MemStateDB) getOrCreate(addr Address) *stateAccount {
+	obj := db.accounts[addr]
+	if obj == nil {
+		obj = &stateAccount{codeHash: emptyCodeHash, storage: make(Store)}
+		db.setAccount(addr, obj)
+	}
+	return obj
+}
+
+// setAccount replaces the account at addr, deleting it if obj is nil.
+func (db *MemStateDB) setAccount(addr Address, obj *stateAccount) {
+	prev := db.accounts[addr]
+	db.journal.append(func() {
+		if prev == nil {
+			delete(db.accounts, addr)
+		} else {
+			db.accounts[addr] = prev
+		}
+	})
+	if obj == nil {
+		delete(db.accounts, addr)
+	} else {
+		db.accounts[addr] = obj
+	}
+}
+
+func (db *MemStateDB) CreateAccount(addr Address) {
+	obj := &stateAccount{codeHash: emptyCodeHash, storage: make(Store)}
+	if prev := db.accounts[addr]; prev != nil {
+		obj.balance = prev.balance
+	}
+	db.setAccount(addr, obj)
+}
+
+func (db *MemStateDB) Exist(addr Address) bool {
+	return db.accounts[addr] != nil
+}
+
+func (db *MemStateDB) Empty(addr Address) bool {
+	obj := db.accounts[addr]
+	return obj == nil || (obj.balance.IsZero() && obj.nonce == 0 && len(obj.code) == 0)
+}
+
+func (db *MemStateDB) GetBalance(addr Address) Word {
+	if obj := db.accounts[addr]; obj != nil {
+		return obj.balance
+	}
+	return Word{}
+}
+
+func (db *MemStateDB) AddBalance(addr Address, amount *Word) {
+	obj := db.getOrCreate(addr)
+	db.setBalance(obj, new(Word).Add(&obj.balance, amount))
+}
+
+func (db *MemStateDB) SubBalance(addr Address, amount *Word) {
+	obj := db.getOrCreate(addr)
+	db.setBalance(obj, new(Word).Sub(&obj.balance, amount))
+}
+
+func (db *MemStateDB) setBalance(obj *stateAccount, balance *Word) {
+	prev := obj.balance
+	db.journal.append(func() { obj.balance = prev })
+	obj.balance = *balance
+}
+
+func (db *MemStateDB) GetNonce(addr Address) uint64 {
+	if obj := db.accounts[addr]; obj != nil {
+		return obj.nonce
+	}
+	return 0
+}
+
+func (db *MemStateDB) SetNonce(addr Address, nonce uint64) {
+	obj := db.getOrCreate(addr)
+	prev := obj.nonce
+	db.journal.append(func() { obj.nonce = prev })
+	obj.nonce = nonce
+}
+
+func (db *MemStateDB) GetCode(addr Address) []byte {
+	if obj := db.accounts[addr]; obj != nil {
+		return obj.code
+	}
+	return nil
+}
+
+func (db *MemStateDB) GetCodeSize(addr Address) int {
+	return len(db.GetCode(addr))
+}
+
+func (db *MemStateDB) GetCodeHash(addr Address) Word {
+	if obj := db.accounts[addr]; obj != nil {
+		return obj.codeHash
+	}
+	return Word{}
+}
+
+func (db *MemStateDB) SetCode(addr Address, code []byte) {
+	obj := db.getOrCreate(addr)
+	prevCode, prevHash := obj.code, obj.codeHash
+	db.journal.append(func() { obj.code, obj.codeHash = prevCode, prevHash })
+	obj.code, obj.codeHash = code, keccak256Word(code)
+}
+
+func (db *MemStateDB) GetState(addr Address, key Word) Word {
+	if obj := db.accounts[addr]; obj != nil {
+		return obj.storage[key]
+	}
+	return Word{}
+}
+
+// SetState sets a storage slot of addr. Slots set to zero are removed.
+func (db *MemStateDB) SetState(addr Address, key, value Word) {
+	obj := db.getOrCreate(addr)
+	prev := obj.storage[key]
+	db.journal.append(func() { setSlot(obj.storage, key, prev) })
+	setSlot(obj.storage, key, value)
+}
+
+func setSlot(storage Store, key, value Word) {
+	if value.IsZero() {
+		delete(storage, key)
+	} else {
+		storage[key] = value
+	}
+}
+
+func (db *MemStateDB) SelfDestruct(addr Address) {
+	if db.accounts[addr] != nil {
+		db.setAccount(addr, nil)
+	}
+}
+
+func (db *MemStateDB) AddLog(log Log) {
+	n := len(db.logs)
+	db.journal.append(func() { db.logs = db.logs[:n] })
+	db.logs = append(db.logs, log)
+}
+
+func (db *MemStateDB) Logs() []Log {
+	return db.logs
+}
+
+func (db *MemStateDB) Snapshot() int {
+	return db.journal.snapshot()
+}
+
+func (db *MemStateDB) RevertToSnapshot(id int) {
+	db.journal.revert(id)
+}
+
+func (db *MemStateDB) Finalise() {
+	db.journal = journal{}
+	db.logs = nil
+}
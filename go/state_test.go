@@ -0,0 +1,158 @@
+package evm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// mustState returns a MemStateDB holding accounts, failing the test if they
+// are malformed.
+func mustState(t *testing.T, accounts Accounts) *MemStateDB {
+	t.Helper()
+	state, err := NewMemStateDB(accounts)
+	if err != nil {
+		t.Fatalf("NewMemStateDB(…) error %v", err)
+	}
+	return state
+}
+
+func TestHexToAddress(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0x00ab000000000000000000000000000000000001", "0x00ab000000000000000000000000000000000001"},
+		{"0xAB", "0x00000000000000000000000000000000000000ab"},
+		{"ab", "0x00000000000000000000000000000000000000ab"},
+		{"", "0x0000000000000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		if got := HexToAddress(tt.in).Hex(); got != tt.want {
+			t.Errorf("HexToAddress(%q) = %s; want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMemStateDBLeadingZeros(t *testing.T) {
+	addr := HexToAddress("0x00ab000000000000000000000000000000000001")
+	state := mustState(t, Accounts{addr.Hex(): {Balance: "0x100", UserCode: usercode{Bin: "6001"}}})
+	// PUSH20 0x00ab…01, DUP1, BALANCE, SWAP1, EXTCODESIZE
+	code := append(append([]byte{0x73}, addr[:]...), 0x80, 0x31, 0x90, 0x3b)
+	res := Evm(code, Transaction{}, BlockContext{}, state)
+	if res.Failed() {
+		t.Fatalf("Evm(…).Err = %v", res.Err)
+	}
+	if got := bigInts(res.Stack); got[0].Int64() != 2 || got[1].Int64() != 0x100 {
+		t.Errorf("EXTCODESIZE, BALANCE = %v; want [2 256]", got)
+	}
+}
+
+func TestMemStateDB(t *testing.T) {
+	addr := HexToAddress("0xaa")
+	state := mustState(t, nil)
+	if state.Exist(addr) || !state.Empty(addr) {
+		t.Fatalf("missing account: Exist = %t, Empty = %t; want false, true", state.Exist(addr), state.Empty(addr))
+	}
+	if got := state.GetCodeHash(addr); !got.IsZero() {
+		t.Errorf("GetCodeHash(missing) = %s; want 0x0", got.Hex())
+	}
+
+	state.AddBalance(addr, NewWord(5))
+	state.SetState(addr, *NewWord(1), *NewWord(2))
+	state.CreateAccount(addr)
+	if got := state.GetBalance(addr); !got.Eq(NewWord(5)) {
+		t.Errorf("balance after CreateAccount = %s; want 0x5", got.Hex())
+	}
+	if got := state.GetState(addr, *NewWord(1)); !got.IsZero() {
+		t.Errorf("storage after CreateAccount = %s; want 0x0", got.Hex())
+	}
+	if got := state.GetCodeHash(addr); got != emptyCodeHash {
+		t.Errorf("GetCodeHash(no code) = %s; want %s", got.Hex(), emptyCodeHash.Hex())
+	}
+	if state.Empty(addr) {
+		t.Errorf("Empty(account with balance) = true; want false")
+	}
+
+	state.SelfDestruct(addr)
+	if state.Exist(addr) {
+		t.Errorf("Exist after SelfDestruct = true; want false")
+	}
+}
+
+func TestMemStateDBAccounts(t *testing.T) {
+	var accounts Accounts
+	if err := json.Unmarshal([]byte(`{"0xaa": {"balance": "0x1", "nonce": "0x3", "code": {"bin": "6001"}, "storage": {"0x1": "0x2a"}}}`), &accounts); err != nil {
+		t.Fatalf("json.Unmarshal error %v", err)
+	}
+	state := mustState(t, accounts)
+	addr := HexToAddress("0xaa")
+	if got := state.GetState(addr, *NewWord(1)); !got.Eq(NewWord(0x2a)) {
+		t.Errorf("storage slot 1 = %s; want 0x2a", got.Hex())
+	}
+	if got := state.GetNonce(addr); got != 3 {
+		t.Errorf("nonce = %d; want 3", got)
+	}
+
+	b, err := json.Marshal(state.Accounts())
+	if err != nil {
+		t.Fatalf("json.Marshal error %v", err)
+	}
+	want := `{"0x00000000000000000000000000000000000000aa":{"balance":"0x1","nonce":"0x3","code":{"asm":"","bin":"6001"},"storage":{"0x1":"0x2a"}}}`
+	if string(b) != want {
+		t.Errorf("json.Marshal(Accounts()) = %s; want %s", b, want)
+	}
+
+	if _, err := NewMemStateDB(Accounts{"0xaa": {UserCode: usercode{Bin: "zz"}}}); err == nil {
+		t.Errorf("NewMemStateDB(bad code) error nil; want an error")
+	}
+}
+
+func TestMemStateDBRevert(t *testing.T) {
+	a, b := HexToAddress("0xaa"), HexToAddress("0xbb")
+	state := mustState(t, Accounts{a.Hex(): {Balance: "0x10", Storage: Store{*NewWord(1): *NewWord(1)}}})
+
+	snapshot := state.Snapshot()
+	state.SubBalance(a, NewWord(4))
+	state.AddBalance(b, NewWord(4))
+	state.SetNonce(a, 1)
+	state.SetState(a, *NewWord(1), Word{})
+	state.SetCode(b, []byte{0x00})
+	state.AddLog(Log{Address: a.Hex()})
+
+	inner := state.Snapshot()
+	state.SelfDestruct(a)
+	state.RevertToSnapshot(inner)
+	if got := state.GetBalance(a); !got.Eq(NewWord(12)) {
+		t.Fatalf("balance after reverting SelfDestruct = %s; want 0xc", got.Hex())
+	}
+
+	state.RevertToSnapshot(snapshot)
+	if got := state.GetBalance(a); !got.Eq(NewWord(16)) {
+		t.Errorf("balance = %s; want 0x10", got.Hex())
+	}
+	if got := state.GetNonce(a); got != 0 {
+		t.Errorf("nonce = %d; want 0", got)
+	}
+	if got := state.GetState(a, *NewWord(1)); !got.Eq(NewWord(1)) {
+		t.Errorf("storage slot 1 = %s; want 0x1", got.Hex())
+	}
+	if state.Exist(b) {
+		t.Errorf("Exist(created account) = true; want false")
+	}
+	if got := state.Logs(); len(got) != 0 {
+		t.Errorf("Logs() = %v; want none", got)
+	}
+}
+
+func TestMemStateDBFinalise(t *testing.T) {
+	addr := HexToAddress("0xaa")
+	state := mustState(t, nil)
+	state.SetState(addr, *NewWord(1), *NewWord(2))
+	state.AddLog(Log{Address: addr.Hex()})
+	state.Finalise()
+	if len(state.journal.undo) != 0 || len(state.Logs()) != 0 {
+		t.Fatalf("after Finalise: %d journal entries, %d logs; want none", len(state.journal.undo), len(state.Logs()))
+	}
+	if got := state.GetState(addr, *NewWord(1)); !got.Eq(NewWord(2)) {
+		t.Errorf("storage slot 1 = %s; want 0x2", got.Hex())
+	}
+}
@@ -0,0 +1,503 @@
+package evm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Word is a 256-bit unsigned integer, the native value type of the EVM. It is
+// stored as four uint64 limbs, least significant first, and all arithmetic on
+// it wraps modulo 2^256.
+//
+// Arithmetic methods follow the math/big convention: the receiver holds the
+// result and is returned, so calls can be chained and operands may alias the
+// receiver. Read-only accessors take the Word by value.
+type Word [4]uint64
+
+// NewWord returns a Word holding x.
+func NewWord(x uint64) *Word {
+	return &Word{x}
+}
+
+// Clear sets z to 0.
+func (z *Word) Clear() *Word {
+	*z = Word{}
+	return z
+}
+
+// Set sets z to x.
+func (z *Word) Set(x *Word) *Word {
+	*z = *x
+	return z
+}
+
+// SetUint64 sets z to x.
+func (z *Word) SetUint64(x uint64) *Word {
+	*z = Word{x}
+	return z
+}
+
+// SetBytes interprets b as a big-endian unsigned integer and sets z to it. If
+// b is longer than 32 bytes only the last 32 are used.
+func (z *Word) SetBytes(b []byte) *Word {
+	if len(b) > 32 {
+		b = b[len(b)-32:]
+	}
+	var buf [32]byte
+	copy(buf[32-len(b):], b)
+	z[3] = binary.BigEndian.Uint64(buf[0:8])
+	z[2] = binary.BigEndian.Uint64(buf[8:16])
+	z[1] = binary.BigEndian.Uint64(buf[16:24])
+	z[0] = binary.BigEndian.Uint64(buf[24:32])
+	return z
+}
+
+// SetFromBig sets z to b modulo 2^256, so negative values are stored in two's
+// complement form.
+func (z *Word) SetFromBig(b *big.Int) *Word {
+	v := new(big.Int).Mod(b, twoTo256)
+	var buf [32]byte
+	return z.SetBytes(v.FillBytes(buf[:]))
+}
+
+var twoTo256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// Bytes32 returns z as a 32-byte big-endian array.
+func (z Word) Bytes32() [32]byte {
+	var b [32]byte
+	binary.BigEndian.PutUint64(b[0:8], z[3])
+	binary.BigEndian.PutUint64(b[8:16], z[2])
+	binary.BigEndian.PutUint64(b[16:24], z[1])
+	binary.BigEndian.PutUint64(b[24:32], z[0])
+	return b
+}
+
+// Bytes returns z as a big-endian byte slice without leading zeros.
+func (z Word) Bytes() []byte {
+	b := z.Bytes32()
+	return b[32-z.ByteLen():]
+}
+
+// ToBig returns z as a *big.Int.
+func (z Word) ToBig() *big.Int {
+	b := z.Bytes32()
+	return new(big.Int).SetBytes(b[:])
+}
+
+// Uint64 returns the low 64 bits of z.
+func (z Word) Uint64() uint64 {
+	return z[0]
+}
+
+// IsUint64 reports whether z fits in a uint64.
+func (z Word) IsUint64() bool {
+	return z[1]|z[2]|z[3] == 0
+}
+
+// IsZero reports whether z is 0.
+func (z Word) IsZero() bool {
+	return z[0]|z[1]|z[2]|z[3] == 0
+}
+
+// BitLen returns the number of bits needed to represent z.
+func (z Word) BitLen() int {
+	for i := 3; i >= 0; i-- {
+		if z[i] != 0 {
+			return i*64 + bits.Len64(z[i])
+		}
+	}
+	return 0
+}
+
+// ByteLen returns the number of bytes needed to represent z.
+func (z Word) ByteLen() int {
+	return (z.BitLen() + 7) / 8
+}
+
+// Hex returns z as a "0x"-prefixed hex string without leading zeros.
+func (z Word) Hex() string {
+	i := 3
+	for i > 0 && z[i] == 0 {
+		i--
+	}
+	var sb strings.Builder
+	sb.WriteString("0x")
+	sb.WriteString(strconv.FormatUint(z[i], 16))
+	for i--; i >= 0; i-- {
+		limb := strconv.FormatUint(z[i], 16)
+		sb.WriteString(strings.Repeat("0", 16-len(limb)))
+		sb.WriteString(limb)
+	}
+	return sb.String()
+}
+
+// String implements fmt.Stringer and returns z in hex.
+func (z Word) String() string {
+	return z.Hex()
+}
+
+// MarshalText implements encoding.TextMarshaler, so that Words can be used as
+// JSON values and map keys. It returns the same text as Hex.
+func (z Word) MarshalText() ([]byte, error) {
+	return []byte(z.Hex()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts a hex quantity
+// of at most 256 bits, with or without the "0x" prefix.
+func (z *Word) UnmarshalText(text []byte) error {
+	s := strings.TrimPrefix(string(text), "0x")
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok || s[0] == '-' || s[0] == '+' || v.BitLen() > 256 {
+		return fmt.Errorf("invalid 256-bit hex quantity %q", text)
+	}
+	z.SetFromBig(v)
+	return nil
+}
+
+// Cmp compares z and x and returns -1, 0 or +1.
+func (z *Word) Cmp(x *Word) int {
+	for i := 3; i >= 0; i-- {
+		if z[i] < x[i] {
+			return -1
+		}
+		if z[i] > x[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Eq reports whether z == x.
+func (z *Word) Eq(x *Word) bool {
+	return *z == *x
+}
+
+// Lt reports whether z < x.
+func (z *Word) Lt(x *Word) bool {
+	return z.Cmp(x) < 0
+}
+
+// Gt reports whether z > x.
+func (z *Word) Gt(x *Word) bool {
+	return z.Cmp(x) > 0
+}
+
+// Add sets z to x + y mod 2^256.
+func (z *Word) Add(x, y *Word) *Word {
+	var carry uint64
+	z[0], carry = bits.Add64(x[0], y[0], 0)
+	z[1], carry = bits.Add64(x[1], y[1], carry)
+	z[2], carry = bits.Add64(x[2], y[2], carry)
+	z[3], _ = bits.Add64(x[3], y[3], carry)
+	return z
+}
+
+// Sub sets z to x - y mod 2^256.
+func (z *Word) Sub(x, y *Word) *Word {
+	var borrow uint64
+	z[0], borrow = bits.Sub64(x[0], y[0], 0)
+	z[1], borrow = bits.Sub64(x[1], y[1], borrow)
+	z[2], borrow = bits.Sub64(x[2], y[2], borrow)
+	z[3], _ = bits.Sub64(x[3], y[3], borrow)
+	return z
+}
+
+// Mul sets z to x * y mod 2^256.
+func (z *Word) Mul(x, y *Word) *Word {
+	var res Word
+	for i := 0; i < 4; i++ {
+		var carry uint64
+		for j := 0; i+j < 4; j++ {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, res[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			res[i+j] = lo
+			carry = hi
+		}
+	}
+	*z = res
+	return z
+}
+
+// Div sets z to x / y, or to 0 if y is 0, as DIV does.
+func (z *Word) Div(x, y *Word) *Word {
+	if y.IsZero() || y.Gt(x) {
+		return z.Clear()
+	}
+	if x.IsUint64() {
+		return z.SetUint64(x[0] / y[0])
+	}
+	var quot [4]uint64
+	udivrem(quot[:], x[:], y)
+	*z = quot
+	return z
+}
+
+// Mod sets z to x % y, or to 0 if y is 0, as MOD does.
+func (z *Word) Mod(x, y *Word) *Word {
+	if y.IsZero() {
+		return z.Clear()
+	}
+	if x.Lt(y) {
+		return z.Set(x)
+	}
+	if x.IsUint64() {
+		return z.SetUint64(x[0] % y[0])
+	}
+	var quot [4]uint64
+	*z = udivrem(quot[:], x[:], y)
+	return z
+}
+
+// AddMod sets z to (x + y) % m without truncating the intermediate sum, or
+// to 0 if m is 0, as ADDMOD does.
+func (z *Word) AddMod(x, y, m *Word) *Word {
+	if m.IsZero() {
+		return z.Clear()
+	}
+	var sum [5]uint64
+	var carry uint64
+	for i := 0; i < 4; i++ {
+		sum[i], carry = bits.Add64(x[i], y[i], carry)
+	}
+	sum[4] = carry
+	var quot [5]uint64
+	*z = udivrem(quot[:], sum[:], m)
+	return z
+}
+
+// MulMod sets z to (x * y) % m without truncating the intermediate product,
+// or to 0 if m is 0, as MULMOD does.
+func (z *Word) MulMod(x, y, m *Word) *Word {
+	if m.IsZero() {
+		return z.Clear()
+	}
+	var product [8]uint64
+	for i := 0; i < 4; i++ {
+		var carry uint64
+		for j := 0; j < 4; j++ {
+			hi, lo := bits.Mul64(x[i], y[j])
+			var c uint64
+			lo, c = bits.Add64(lo, product[i+j], 0)
+			hi += c
+			lo, c = bits.Add64(lo, carry, 0)
+			hi += c
+			product[i+j] = lo
+			carry = hi
+		}
+		product[i+4] = carry
+	}
+	var quot [8]uint64
+	*z = udivrem(quot[:], product[:], m)
+	return z
+}
+
+// Exp sets z to base**exponent mod 2^256.
+func (z *Word) Exp(base, exponent *Word) *Word {
+	res := Word{1}
+	b := *base
+	for i, n := 0, exponent.BitLen(); i < n; i++ {
+		if exponent[i/64]>>(i%64)&1 == 1 {
+			res.Mul(&res, &b)
+		}
+		b.Mul(&b, &b)
+	}
+	*z = res
+	return z
+}
+
+// And sets z to x & y.
+func (z *Word) And(x, y *Word) *Word {
+	z[0], z[1], z[2], z[3] = x[0]&y[0], x[1]&y[1], x[2]&y[2], x[3]&y[3]
+	return z
+}
+
+// Or sets z to x | y.
+func (z *Word) Or(x, y *Word) *Word {
+	z[0], z[1], z[2], z[3] = x[0]|y[0], x[1]|y[1], x[2]|y[2], x[3]|y[3]
+	return z
+}
+
+// Xor sets z to x ^ y.
+func (z *Word) Xor(x, y *Word) *Word {
+	z[0], z[1], z[2], z[3] = x[0]^y[0], x[1]^y[1], x[2]^y[2], x[3]^y[3]
+	return z
+}
+
+// Not sets z to ^x.
+func (z *Word) Not(x *Word) *Word {
+	z[0], z[1], z[2], z[3] = ^x[0], ^x[1], ^x[2], ^x[3]
+	return z
+}
+
+// Lsh sets z to x << n, discarding bits shifted past the top.
+func (z *Word) Lsh(x *Word, n uint) *Word {
+	if n >= 256 {
+		return z.Clear()
+	}
+	limbs, shift := int(n/64), n%64
+	var res Word
+	for i := 3; i >= limbs; i-- {
+		res[i] = x[i-limbs] << shift
+		if i-limbs > 0 {
+			res[i] |= x[i-limbs-1] >> (64 - shift)
+		}
+	}
+	*z = res
+	return z
+}
+
+// Rsh sets z to x >> n, filling with zeros.
+func (z *Word) Rsh(x *Word, n uint) *Word {
+	if n >= 256 {
+		return z.Clear()
+	}
+	limbs, shift := int(n/64), n%64
+	var res Word
+	for i := 0; i < 4-limbs; i++ {
+		res[i] = x[i+limbs] >> shift
+		if i+limbs < 3 {
+			res[i] |= x[i+limbs+1] << (64 - shift)
+		}
+	}
+	*z = res
+	return z
+}
+
+// Byte sets z to the n-th byte of x, counting from the most significant one,
+// or to 0 if n is 32 or more, as BYTE does.
+func (z *Word) Byte(n, x *Word) *Word {
+	if !n.IsUint64() || n[0] >= 32 {
+		return z.Clear()
+	}
+	limb := x[3-n[0]/8]
+	return z.SetUint64(limb >> (56 - (n[0]%8)*8) & 0xff)
+}
+
+// Sign interprets z as a two's complement signed integer and returns -1, 0 or
+// +1 depending on its sign.
+func (z Word) Sign() int {
+	if z.IsZero() {
+		return 0
+	}
+	if z[3]>>63 == 1 {
+		return -1
+	}
+	return 1
+}
+
+// Neg sets z to -x mod 2^256.
+func (z *Word) Neg(x *Word) *Word {
+	return z.Sub(&Word{}, x)
+}
+
+// Abs sets z to the magnitude of x interpreted as a two's complement signed
+// integer. The magnitude of the smallest value, -2^255, is itself.
+func (z *Word) Abs(x *Word) *Word {
+	if x.Sign() < 0 {
+		return z.Neg(x)
+	}
+	return z.Set(x)
+}
+
+// udivrem divides u by d, stores the quotient in quot and returns the
+// remainder. It implements Knuth's Algorithm D (TAOCP vol. 2, 4.3.1). d must
+// not be zero and quot must have room for len(u) limbs.
+func udivrem(quot, u []uint64, d *Word) (rem Word) {
+	dLen := 0
+	for i := 3; i >= 0; i-- {
+		if d[i] != 0 {
+			dLen = i + 1
+			break
+		}
+	}
+	uLen := 0
+	for i := len(u) - 1; i >= 0; i-- {
+		if u[i] != 0 {
+			uLen = i + 1
+			break
+		}
+	}
+	if uLen < dLen {
+		copy(rem[:], u)
+		return rem
+	}
+
+	// Normalize so that the top bit of the divisor is set.
+	shift := uint(bits.LeadingZeros64(d[dLen-1]))
+	var dnBuf Word
+	dn := dnBuf[:dLen]
+	for i := dLen - 1; i > 0; i-- {
+		dn[i] = d[i]<<shift | d[i-1]>>(64-shift)
+	}
+	dn[0] = d[0] << shift
+
+	var unBuf [9]uint64
+	un := unBuf[:uLen+1]
+	un[uLen] = u[uLen-1] >> (64 - shift)
+	for i := uLen - 1; i > 0; i-- {
+		un[i] = u[i]<<shift | u[i-1]>>(64-shift)
+	}
+	un[0] = u[0] << shift
+
+	if dLen == 1 {
+		r := un[uLen]
+		for j := uLen - 1; j >= 0; j-- {
+			quot[j], r = bits.Div64(r, un[j], dn[0])
+		}
+		rem[0] = r >> shift
+		return rem
+	}
+
+	dh, dl := dn[dLen-1], dn[dLen-2]
+	for j := uLen - dLen; j >= 0; j-- {
+		u2, u1, u0 := un[j+dLen], un[j+dLen-1], un[j+dLen-2]
+
+		// Estimate the quotient digit from the top limbs; it is at most one
+		// too large after the correction below.
+		var qhat uint64
+		if u2 >= dh {
+			qhat = ^uint64(0)
+		} else {
+			var rhat uint64
+			qhat, rhat = bits.Div64(u2, u1, dh)
+			ph, pl := bits.Mul64(qhat, dl)
+			if ph > rhat || (ph == rhat && pl > u0) {
+				qhat--
+			}
+		}
+
+		// Multiply and subtract, adding back if qhat was too large.
+		var borrow uint64
+		for i := 0; i < dLen; i++ {
+			s, b1 := bits.Sub64(un[j+i], borrow, 0)
+			ph, pl := bits.Mul64(dn[i], qhat)
+			t, b2 := bits.Sub64(s, pl, 0)
+			un[j+i] = t
+			borrow = ph + b1 + b2
+		}
+		un[j+dLen] = u2 - borrow
+		if u2 < borrow {
+			qhat--
+			var carry uint64
+			for i := 0; i < dLen; i++ {
+				un[j+i], carry = bits.Add64(un[j+i], dn[i], carry)
+			}
+			un[j+dLen] += carry
+		}
+		quot[j] = qhat
+	}
+
+	for i := 0; i < dLen-1; i++ {
+		rem[i] = un[i]>>shift | un[i+1]<<(64-shift)
+	}
+	rem[dLen-1] = un[dLen-1] >> shift
+	return rem
+}
@@ -0,0 +1,105 @@
+package evm
+
+import (
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randWord returns a Word with a random number of random low bytes, so that
+// the operands exercise every limb length.
+func randWord(r *rand.Rand) Word {
+	b := make([]byte, r.Intn(33))
+	r.Read(b)
+	var w Word
+	w.SetBytes(b)
+	return w
+}
+
+func TestWordArithmetic(t *testing.T) {
+	mod := func(x *big.Int) *big.Int { return x.Mod(x, twoTo256) }
+	tests := []struct {
+		name string
+		word func(x, y, m *Word) *Word
+		big  func(x, y, m *big.Int) *big.Int
+	}{
+		{"ADD", func(x, y, _ *Word) *Word { return new(Word).Add(x, y) }, func(x, y, _ *big.Int) *big.Int { return mod(x.Add(x, y)) }},
+		{"SUB", func(x, y, _ *Word) *Word { return new(Word).Sub(x, y) }, func(x, y, _ *big.Int) *big.Int { return mod(x.Sub(x, y)) }},
+		{"MUL", func(x, y, _ *Word) *Word { return new(Word).Mul(x, y) }, func(x, y, _ *big.Int) *big.Int { return mod(x.Mul(x, y)) }},
+		{"DIV", func(x, y, _ *Word) *Word { return new(Word).Div(x, y) }, func(x, y, _ *big.Int) *big.Int {
+			if y.Sign() == 0 {
+				return y
+			}
+			return x.Div(x, y)
+		}},
+		{"MOD", func(x, y, _ *Word) *Word { return new(Word).Mod(x, y) }, func(x, y, _ *big.Int) *big.Int {
+			if y.Sign() == 0 {
+				return y
+			}
+			return x.Mod(x, y)
+		}},
+		{"ADDMOD", func(x, y, m *Word) *Word { return new(Word).AddMod(x, y, m) }, func(x, y, m *big.Int) *big.Int {
+			if m.Sign() == 0 {
+				return m
+			}
+			return x.Mod(x.Add(x, y), m)
+		}},
+		{"MULMOD", func(x, y, m *Word) *Word { return new(Word).MulMod(x, y, m) }, func(x, y, m *big.Int) *big.Int {
+			if m.Sign() == 0 {
+				return m
+			}
+			return x.Mod(x.Mul(x, y), m)
+		}},
+		{"EXP", func(x, y, _ *Word) *Word { return new(Word).Exp(x, y) }, func(x, y, _ *big.Int) *big.Int { return x.Exp(x, y, twoTo256) }},
+		{"SHL", func(x, y, _ *Word) *Word { return new(Word).Lsh(x, uint(y[0]%300)) }, func(x, y, _ *big.Int) *big.Int {
+			return mod(x.Lsh(x, uint(low64(y)%300)))
+		}},
+		{"SHR", func(x, y, _ *Word) *Word { return new(Word).Rsh(x, uint(y[0]%300)) }, func(x, y, _ *big.Int) *big.Int {
+			return x.Rsh(x, uint(low64(y)%300))
+		}},
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 2000; i++ {
+				x, y, m := randWord(r), randWord(r), randWord(r)
+				got := tt.word(&x, &y, &m)
+				want := tt.big(x.ToBig(), y.ToBig(), m.ToBig())
+				if got.ToBig().Cmp(want) != 0 {
+					t.Fatalf("%s(%s, %s, %s) = %s; want %#x", tt.name, x.Hex(), y.Hex(), m.Hex(), got.Hex(), want)
+				}
+			}
+		})
+	}
+}
+
+// low64 returns the low 64 bits of x, like Word.Uint64.
+func low64(x *big.Int) uint64 {
+	return new(big.Int).And(x, new(big.Int).SetUint64(^uint64(0))).Uint64()
+}
+
+func TestWordConversions(t *testing.T) {
+	var w Word
+	w.SetBytes([]byte{0x01, 0x02, 0x03})
+	if got, want := w.Hex(), "0x10203"; got != want {
+		t.Errorf("Hex() = %s; want %s", got, want)
+	}
+	if got := w.Bytes(); string(got) != "\x01\x02\x03" {
+		t.Errorf("Bytes() = %x; want 010203", got)
+	}
+	w.SetFromBig(big.NewInt(-1))
+	if got, want := w.Hex(), "0x"+strings.Repeat("f", 64); got != want {
+		t.Errorf("SetFromBig(-1).Hex() = %s; want %s", got, want)
+	}
+	if w.Sign() != -1 {
+		t.Errorf("SetFromBig(-1).Sign() = %d; want -1", w.Sign())
+	}
+	if got := new(Word).Abs(&w); !got.Eq(NewWord(1)) {
+		t.Errorf("Abs(-1) = %s; want 0x1", got.Hex())
+	}
+	if got := new(Word).Byte(NewWord(31), NewWord(0xab)); !got.Eq(NewWord(0xab)) {
+		t.Errorf("Byte(31, 0xab) = %s; want 0xab", got.Hex())
+	}
+}